@@ -0,0 +1,270 @@
+// Package batch renders multiple diagrams concurrently, using a pool of workers.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate defines the default name of the output files, which mirror the tree of the sources.
+const DefaultTemplate = "{{.Rel}}/{{.Name}}.png"
+
+// stampFile is the name of the file recording the digest of the rendering options of
+// the outputs found in the same directory.
+const stampFile = ".diagram-stamps"
+
+// Job defines a diagram to be rendered from the source into the output file.
+type Job struct {
+	Source string
+	Output string
+	// Digest identifies the rendering options, so the output is rendered again when they change.
+	Digest string
+}
+
+// Result holds the outcome of a job.
+type Result struct {
+	Job
+	// Skipped is true when the output was up to date, so the job was not run.
+	Skipped  bool
+	Err      error
+	Duration time.Duration
+}
+
+// Summary counts the results by their outcome.
+type Summary struct {
+	Rendered, Skipped, Failed int
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d rendered, %d up to date, %d failed", s.Rendered, s.Skipped, s.Failed)
+}
+
+// Summarize returns the summary of the results.
+func Summarize(results []Result) Summary {
+	var s Summary
+	for _, res := range results {
+		switch {
+		case res.Err != nil:
+			s.Failed++
+		case res.Skipped:
+			s.Skipped++
+		default:
+			s.Rendered++
+		}
+	}
+	return s
+}
+
+// NameData holds the fields which can be used in the output name template.
+type NameData struct {
+	// Name is the source file name without the extension.
+	Name string
+	// Ext is the source file extension, including the dot.
+	Ext string
+	// Dir is the directory of the source file.
+	Dir string
+	// Rel is the directory of the source file relative to the deepest directory
+	// containing all the sources, or "." for the sources found in that directory.
+	Rel string
+}
+
+// Digest returns the digest of the rendering options, to be set on the jobs.
+func Digest(options ...string) string {
+	h := sha256.New()
+	for _, opt := range options {
+		fmt.Fprintf(h, "%d:%s", len(opt), opt)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Jobs creates the jobs for the source files, naming the outputs using the template.
+// The output names are relative to the output directory. The digest of the rendering
+// options is set on every job.
+func Jobs(sources []string, outDir, nameTemplate, digest string) ([]Job, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template: %w", err)
+	}
+
+	jobs := make([]Job, 0, len(sources))
+	outputs := make(map[string]string)
+	root := commonDir(sources)
+	for _, src := range sources {
+		ext := filepath.Ext(src)
+		data := NameData{
+			Name: strings.TrimSuffix(filepath.Base(src), ext),
+			Ext:  ext,
+			Dir:  filepath.Dir(src),
+			Rel:  ".",
+		}
+		if rel, err := filepath.Rel(root, filepath.Dir(absPath(src))); err == nil {
+			data.Rel = filepath.ToSlash(rel)
+		}
+
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("cannot name the output of %q: %w", src, err)
+		}
+		out := filepath.Join(outDir, buf.String())
+		if prev, ok := outputs[out]; ok {
+			return nil, fmt.Errorf("both %q and %q would be rendered into %q", prev, src, out)
+		}
+		outputs[out] = src
+
+		jobs = append(jobs, Job{Source: src, Output: out, Digest: digest})
+	}
+	return jobs, nil
+}
+
+// commonDir returns the deepest directory containing all the sources.
+func commonDir(sources []string) string {
+	var root string
+	for i, src := range sources {
+		dir := filepath.Dir(absPath(src))
+		if i == 0 {
+			root = dir
+			continue
+		}
+		for root != filepath.Dir(root) {
+			if rel, err := filepath.Rel(root, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				break
+			}
+			root = filepath.Dir(root)
+		}
+	}
+	return root
+}
+
+// absPath returns the absolute path of the file, or the path itself if it cannot be resolved.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// UpToDate reports whether the output of the job is newer than its source,
+// and was rendered with the same options as the ones of the job.
+func UpToDate(job Job) bool {
+	src, err := os.Stat(job.Source)
+	if err != nil {
+		return false
+	}
+	out, err := os.Stat(job.Output)
+	if err != nil {
+		return false
+	}
+	if out.ModTime().Before(src.ModTime()) {
+		return false
+	}
+	return job.Digest == "" || readStamps(filepath.Dir(job.Output))[filepath.Base(job.Output)] == job.Digest
+}
+
+// stampMu serializes the updates of the stamp files.
+var stampMu sync.Mutex
+
+// readStamps returns the digests recorded in the stamp file of the directory, by output name.
+func readStamps(dir string) map[string]string {
+	stamps := make(map[string]string)
+	f, err := os.Open(filepath.Join(dir, stampFile))
+	if err != nil {
+		return stamps
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if digest, name, ok := strings.Cut(scanner.Text(), " "); ok {
+			stamps[name] = digest
+		}
+	}
+	return stamps
+}
+
+// writeStamp records the digest of the job in the stamp file of its output directory.
+func writeStamp(job Job) error {
+	stampMu.Lock()
+	defer stampMu.Unlock()
+
+	dir := filepath.Dir(job.Output)
+	stamps := readStamps(dir)
+	stamps[filepath.Base(job.Output)] = job.Digest
+
+	names := make([]string, 0, len(stamps))
+	for name := range stamps {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s %s\n", stamps[name], name)
+	}
+	return os.WriteFile(filepath.Join(dir, stampFile), buf.Bytes(), 0o644)
+}
+
+// Run executes the jobs using the given number of workers. The jobs whose output is
+// up to date are skipped, unless force is set. The results are returned in the order of the jobs.
+// Once the context is canceled the remaining jobs fail with the context error.
+func Run(ctx context.Context, jobs []Job, workers int, force bool, render func(Job) error) []Result {
+	results := make([]Result, len(jobs))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range queue {
+				results[idx] = run(ctx, jobs[idx], force, render)
+			}
+		}()
+	}
+
+	for idx := range jobs {
+		queue <- idx
+	}
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+// run executes a single job.
+func run(ctx context.Context, job Job, force bool, render func(Job) error) Result {
+	res := Result{Job: job}
+	if err := ctx.Err(); err != nil {
+		res.Err = err
+		return res
+	}
+	if !force && UpToDate(job) {
+		res.Skipped = true
+		return res
+	}
+
+	start := time.Now()
+	if err := os.MkdirAll(filepath.Dir(job.Output), os.ModePerm); err != nil {
+		res.Err = fmt.Errorf("cannot create the output directory: %w", err)
+		return res
+	}
+	res.Err = render(job)
+	res.Duration = time.Since(start)
+	if res.Err == nil && job.Digest != "" {
+		if err := writeStamp(job); err != nil {
+			res.Err = fmt.Errorf("cannot record the rendering options: %w", err)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,212 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles creates the files in the directory, returning their paths.
+func writeFiles(t *testing.T, dir string, names ...string) []string {
+	t.Helper()
+	var paths []string
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("+---+\n| a |\n+---+\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestJobs(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		sources  []string
+		template string
+		want     []string
+		err      string
+	}{
+		{
+			name:     "default template",
+			sources:  []string{"docs/a/flow.txt", "docs/b/flow.txt", "docs/index.txt"},
+			template: DefaultTemplate,
+			want:     []string{"out/a/flow.png", "out/b/flow.png", "out/index.png"},
+		},
+		{
+			name:     "single directory",
+			sources:  []string{"docs/a/flow.txt", "docs/a/seq.json"},
+			template: DefaultTemplate,
+			want:     []string{"out/flow.png", "out/seq.png"},
+		},
+		{
+			name:     "fields",
+			sources:  []string{"docs/a/flow.txt"},
+			template: "{{.Name}}{{.Ext}}.svg",
+			want:     []string{"out/flow.txt.svg"},
+		},
+		{
+			name:     "collision",
+			sources:  []string{"docs/a/flow.txt", "docs/b/flow.txt"},
+			template: "{{.Name}}.png",
+			err:      "would be rendered into",
+		},
+		{
+			name:     "unknown field",
+			sources:  []string{"docs/a/flow.txt"},
+			template: "{{.Base}}.png",
+			err:      "cannot name the output",
+		},
+		{
+			name:     "invalid template",
+			sources:  []string{"docs/a/flow.txt"},
+			template: "{{.Name",
+			err:      "invalid name template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sources []string
+			for _, src := range tt.sources {
+				sources = append(sources, filepath.Join(dir, src))
+			}
+			jobs, err := Jobs(sources, filepath.Join(dir, "out"), tt.template, "digest")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) != len(tt.want) {
+				t.Fatalf("got %d jobs, want %d", len(jobs), len(tt.want))
+			}
+			for i, job := range jobs {
+				if want := filepath.Join(dir, tt.want[i]); job.Output != want {
+					t.Errorf("got output %q, want %q", job.Output, want)
+				}
+				if job.Source != sources[i] || job.Digest != "digest" {
+					t.Errorf("got job %+v", job)
+				}
+			}
+		})
+	}
+}
+
+func TestDigest(t *testing.T) {
+	if Digest("a", "b") == Digest("ab", "") {
+		t.Error("the digest does not separate the options")
+	}
+	if Digest("a", "b") != Digest("a", "b") {
+		t.Error("the digest is not stable")
+	}
+}
+
+func TestRunSkipsUpToDate(t *testing.T) {
+	dir := t.TempDir()
+	sources := writeFiles(t, dir, "src/a.txt", "src/b.txt")
+	outDir := filepath.Join(dir, "out")
+
+	var rendered []string
+	render := func(job Job) error {
+		rendered = append(rendered, filepath.Base(job.Source))
+		return os.WriteFile(job.Output, nil, 0o644)
+	}
+	run := func(digest string, force bool) []string {
+		t.Helper()
+		rendered = nil
+		jobs, err := Jobs(sources, outDir, DefaultTemplate, digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A single worker calls render sequentially.
+		for _, res := range Run(context.Background(), jobs, 1, force, render) {
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+		}
+		return rendered
+	}
+
+	steps := []struct {
+		name   string
+		digest string
+		force  bool
+		stale  string
+		want   string
+	}{
+		{name: "missing outputs", digest: "v1", want: "a.txt b.txt"},
+		{name: "up to date", digest: "v1", want: ""},
+		{name: "source modified", digest: "v1", stale: filepath.Join(outDir, "b.png"), want: "b.txt"},
+		{name: "options changed", digest: "v2", want: "a.txt b.txt"},
+		{name: "forced", digest: "v2", force: true, want: "a.txt b.txt"},
+		{name: "no digest", digest: "", want: ""},
+	}
+	for _, step := range steps {
+		if step.stale != "" {
+			// The output is made older than its source.
+			past := time.Now().Add(-time.Hour)
+			if err := os.Chtimes(step.stale, past, past); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := strings.Join(run(step.digest, step.force), " "); got != step.want {
+			t.Errorf("%s: got rendered %q, want %q", step.name, got, step.want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	sources := writeFiles(t, dir, "a.txt", "b.txt", "c.txt", "d.txt")
+	jobs, err := Jobs(sources, filepath.Join(dir, "out"), DefaultTemplate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errRender := errors.New("cannot render")
+	results := Run(context.Background(), jobs, 3, false, func(job Job) error {
+		if name := filepath.Base(job.Source); name == "b.txt" || name == "d.txt" {
+			return errRender
+		}
+		return os.WriteFile(job.Output, nil, 0o644)
+	})
+	for i, res := range results {
+		if res.Source != jobs[i].Source {
+			t.Fatalf("result %d is for %q, want %q", i, res.Source, jobs[i].Source)
+		}
+		if failed := i%2 == 1; failed != errors.Is(res.Err, errRender) {
+			t.Errorf("%s: got error %v", res.Source, res.Err)
+		}
+	}
+	if got, want := Summarize(results), (Summary{Rendered: 2, Failed: 2}); got != want {
+		t.Errorf("got summary %v, want %v", got, want)
+	}
+
+	// Once the context is canceled none of the jobs are rendered.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = Run(ctx, jobs, 2, true, func(Job) error {
+		t.Error("job rendered after the cancellation")
+		return nil
+	})
+	for _, res := range results {
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Errorf("%s: got error %v, want %v", res.Source, res.Err, context.Canceled)
+		}
+	}
+	if got, want := Summarize(results), (Summary{Failed: 4}); got != want {
+		t.Errorf("got summary %v, want %v", got, want)
+	}
+}
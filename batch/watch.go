@@ -0,0 +1,84 @@
+package batch
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Watcher polls the source files and renders them whenever they change.
+type Watcher struct {
+	// List returns the jobs to watch. It's called on every poll, so new sources are picked up too.
+	List func() ([]Job, error)
+	// Render renders a single job.
+	Render func(Job) error
+	// Report is called with the outcome of every rendering.
+	Report func(Result)
+	// Error is called when the jobs cannot be listed.
+	Error func(error)
+
+	// Interval defines how often the sources are polled.
+	Interval time.Duration
+	// Debounce defines how long a source must remain unchanged before it is rendered,
+	// so a burst of writes results in a single rendering.
+	Debounce time.Duration
+	// Workers defines the number of sources rendered in parallel.
+	Workers int
+}
+
+// Run watches the sources until the context is canceled. Initially only the sources
+// whose output is missing or out of date are rendered.
+func (w *Watcher) Run(ctx context.Context) error {
+	modTimes := make(map[string]time.Time)
+	pending := make(map[string]time.Time)
+	var lastErr string
+
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for first := true; ; first = false {
+		jobs, err := w.List()
+		if err != nil {
+			// Report the error only once, not on every poll.
+			if err.Error() != lastErr && w.Error != nil {
+				w.Error(err)
+			}
+			lastErr = err.Error()
+		} else {
+			lastErr = ""
+		}
+
+		now := time.Now()
+		var ready []Job
+		for _, job := range jobs {
+			info, err := os.Stat(job.Source)
+			if err != nil {
+				continue
+			}
+			if mt, ok := modTimes[job.Source]; !ok || !mt.Equal(info.ModTime()) {
+				modTimes[job.Source] = info.ModTime()
+				if !first || !UpToDate(job) {
+					pending[job.Source] = now
+				}
+			}
+			if changed, ok := pending[job.Source]; ok && now.Sub(changed) >= w.Debounce {
+				delete(pending, job.Source)
+				ready = append(ready, job)
+			}
+		}
+
+		if len(ready) > 0 {
+			for _, res := range Run(ctx, ready, w.Workers, true, w.Render) {
+				if w.Report != nil {
+					w.Report(res)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherDebounce(t *testing.T) {
+	dir := t.TempDir()
+	sources := writeFiles(t, dir, "a.txt")
+	jobs, err := Jobs(sources, dir, DefaultTemplate, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The output is up to date, so nothing is rendered when the watcher starts.
+	start := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(sources[0], start, start); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jobs[0].Output, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan Result, 10)
+	w := &Watcher{
+		List:     func() ([]Job, error) { return jobs, nil },
+		Render:   func(Job) error { return nil },
+		Report:   func(res Result) { results <- res },
+		Interval: 10 * time.Millisecond,
+		Debounce: 100 * time.Millisecond,
+		Workers:  1,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	// A burst of writes, each of them within the debounce duration of the previous one.
+	time.Sleep(30 * time.Millisecond)
+	for i := 1; i <= 5; i++ {
+		mtime := start.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(sources[0], mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	select {
+	case res := <-results:
+		if res.Err != nil || res.Source != sources[0] || res.Output != filepath.Join(dir, "a.png") {
+			t.Errorf("got result %+v", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the modified source was not rendered")
+	}
+	select {
+	case res := <-results:
+		t.Errorf("got a second rendering %+v", res)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,219 @@
+package canvas
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+	"time"
+
+	"github.com/fogleman/gg"
+)
+
+// The default timing of the animations.
+const (
+	DefaultFrameRate      = 20
+	DefaultStrokeDuration = 250 * time.Millisecond
+	DefaultHold           = 2 * time.Second
+)
+
+// Animation defines the timing of the animated diagrams, which replay the drawing
+// of the figures one stroke after another, as if they were drawn by hand.
+type Animation struct {
+	// FrameRate is the number of frames per second. Defaults to DefaultFrameRate.
+	FrameRate float64
+	// StrokeDuration is the time spent drawing a single stroke, line ending or label.
+	// Defaults to DefaultStrokeDuration.
+	StrokeDuration time.Duration
+	// Hold is the time the complete diagram is shown before the animation restarts.
+	// Defaults to DefaultHold.
+	Hold time.Duration
+}
+
+// frameWriter collects the animation frames and encodes them.
+type frameWriter interface {
+	// add adds the r area of the image as a new frame, shown for the given duration.
+	add(img *image.RGBA, r image.Rectangle, delay time.Duration) error
+	// extend extends the display duration of the last frame.
+	extend(delay time.Duration)
+	// encode encodes the frames, along with the final image of the animation if the format has a use for it.
+	encode(w io.Writer, final *image.RGBA) error
+}
+
+// RenderAnimation draws the scene figures in their order, stroke by stroke, and encodes the frames
+// into w as an animated GIF or, for the PNG format, as an animated PNG (APNG).
+func RenderAnimation(ctx context.Context, scene *Scene, w io.Writer, opts Options, anim Animation) error {
+	var frames frameWriter
+	switch opts.Format {
+	case GIF:
+		frames = &gifWriter{}
+	case "", PNG:
+		frames = &apngWriter{}
+	default:
+		return fmt.Errorf("unsupported animation format: %q", opts.Format)
+	}
+	if anim.FrameRate <= 0 {
+		anim.FrameRate = DefaultFrameRate
+	}
+	if anim.StrokeDuration <= 0 {
+		anim.StrokeDuration = DefaultStrokeDuration
+	}
+	if anim.Hold <= 0 {
+		anim.Hold = DefaultHold
+	}
+
+	rec := &recorder{}
+	canvas, err := drawScene(ctx, scene, opts, rec)
+	if err != nil {
+		return err
+	}
+
+	width, height := canvas.Width(), canvas.Height()
+	base := gg.NewContext(width, height)
+	base.Scale(canvas.scale, canvas.scale)
+	base.SetHexColor(canvas.theme.Background)
+	base.Clear()
+
+	interval := time.Duration(float64(time.Second) / anim.FrameRate)
+	total := time.Duration(len(rec.ops)) * anim.StrokeDuration
+
+	var prev *image.RGBA
+	done := 0 // the number of operations completely drawn onto the base
+	for t := interval; ; t += interval {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for ; done < len(rec.ops) && time.Duration(done+1)*anim.StrokeDuration <= t; done++ {
+			rec.ops[done].draw(base, 1, canvas.scale)
+		}
+
+		frame := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(frame, frame.Bounds(), base.Image(), image.Point{}, draw.Src)
+		if done < len(rec.ops) {
+			progress := float64(t-time.Duration(done)*anim.StrokeDuration) / float64(anim.StrokeDuration)
+			dc := gg.NewContextForRGBA(frame)
+			dc.Scale(canvas.scale, canvas.scale)
+			rec.ops[done].draw(dc, progress, canvas.scale)
+		}
+
+		r := frame.Bounds()
+		if prev != nil {
+			r = changedRect(prev, frame)
+		}
+		if r.Empty() {
+			frames.extend(interval)
+		} else if err := frames.add(frame, r, interval); err != nil {
+			return err
+		}
+		prev = frame
+
+		if t >= total {
+			break
+		}
+	}
+	frames.extend(anim.Hold)
+
+	return frames.encode(w, prev)
+}
+
+// draw draws the operation onto the context. A partial progress draws only the beginning
+// of the stroke or of the text, while the dots and the filled areas are drawn at once.
+func (o op) draw(dc *gg.Context, progress, scale float64) {
+	if progress <= 0 {
+		return
+	}
+	progress = min(progress, 1)
+	dc.SetHexColor(o.color)
+
+	switch o.kind {
+	case strokeOp:
+		// The line width is not affected by the context transformation matrix.
+		dc.SetLineWidth(o.width * scale)
+		n := progress * float64(len(o.curves))
+		for i, c := range o.curves {
+			if float64(i) >= n {
+				break
+			}
+			if rest := n - float64(i); rest < 1 {
+				c = c.split(rest)
+			}
+			dc.MoveTo(c.x0, c.y0)
+			dc.CubicTo(c.x1, c.y1, c.x2, c.y2, c.x3, c.y3)
+		}
+		dc.Stroke()
+	case dotOp:
+		// The dot is filled multiple times, exactly like the bulb drawn by the canvas.
+		for i := 0; i < 3; i++ {
+			dc.DrawArc(o.x, o.y, o.r, 0, math.Pi*2)
+			dc.ClosePath()
+			dc.Fill()
+		}
+	case fillOp:
+		dc.MoveTo(o.curves[0].x0, o.curves[0].y0)
+		for _, c := range o.curves {
+			dc.CubicTo(c.x1, c.y1, c.x2, c.y2, c.x3, c.y3)
+		}
+		dc.ClosePath()
+		dc.Fill()
+	case textOp:
+		runes := []rune(o.text)
+		n := int(math.Ceil(progress * float64(len(runes))))
+		dc.SetFontFace(o.face)
+		dc.DrawString(string(runes[:n]), o.x, o.y)
+	}
+}
+
+// changedRect returns the smallest rectangle containing the pixels which differ between the two images.
+func changedRect(a, b *image.RGBA) image.Rectangle {
+	var r image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rowB := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		if bytes.Equal(rowA, rowB) {
+			continue
+		}
+		x0, x1 := 0, len(rowA)/4-1
+		for ; x0 < x1 && bytes.Equal(rowA[x0*4:x0*4+4], rowB[x0*4:x0*4+4]); x0++ {
+		}
+		for ; x1 > x0 && bytes.Equal(rowA[x1*4:x1*4+4], rowB[x1*4:x1*4+4]); x1-- {
+		}
+		r = r.Union(image.Rect(bounds.Min.X+x0, y, bounds.Min.X+x1+1, y+1))
+	}
+	return r
+}
+
+// gifWriter encodes the frames as an animated GIF.
+type gifWriter struct {
+	anim gif.GIF
+	// delays holds the exact frame durations, which are rounded to hundredths of a second when encoded.
+	delays []time.Duration
+}
+
+func (g *gifWriter) add(img *image.RGBA, r image.Rectangle, delay time.Duration) error {
+	g.anim.Image = append(g.anim.Image, quantize(img.SubImage(r)))
+	g.delays = append(g.delays, delay)
+	return nil
+}
+
+func (g *gifWriter) extend(delay time.Duration) {
+	if len(g.delays) > 0 {
+		g.delays[len(g.delays)-1] += delay
+	}
+}
+
+func (g *gifWriter) encode(w io.Writer, final *image.RGBA) error {
+	g.anim.Delay = make([]int, len(g.delays))
+	for i, d := range g.delays {
+		// Most viewers don't respect the delays shorter than 2/100 seconds.
+		g.anim.Delay[i] = max(2, int(d.Round(10*time.Millisecond)/(10*time.Millisecond)))
+	}
+	if err := gif.EncodeAll(w, &g.anim); err != nil {
+		return fmt.Errorf("error encoding the GIF animation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package canvas
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"image/png"
+	"testing"
+	"time"
+)
+
+// pngChunk is a chunk of a PNG file.
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readChunks splits the PNG file into its chunks.
+func readChunks(t *testing.T, file []byte) []pngChunk {
+	t.Helper()
+	if !bytes.HasPrefix(file, []byte(pngSignature)) {
+		t.Fatal("missing PNG signature")
+	}
+	var chunks []pngChunk
+	for data := file[len(pngSignature):]; len(data) > 0; {
+		if len(data) < 12 {
+			t.Fatalf("truncated chunk")
+		}
+		length := binary.BigEndian.Uint32(data)
+		chunks = append(chunks, pngChunk{string(data[4:8]), data[8 : 8+length]})
+		data = data[12+length:]
+	}
+	return chunks
+}
+
+func TestRenderAnimation(t *testing.T) {
+	fonts, err := DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	scene, _ := (&Diagram{}).Parse(testDiagram)
+	anim := Animation{FrameRate: 10, StrokeDuration: 250 * time.Millisecond, Hold: time.Second}
+	rec := &recorder{}
+	if _, err := drawScene(context.Background(), scene, Options{Fonts: fonts, Seed: 1}, rec); err != nil {
+		t.Fatal(err)
+	}
+	render := func(format Format) []byte {
+		var buf bytes.Buffer
+		opts := Options{Format: format, Fonts: fonts, Seed: 1}
+		if err := RenderAnimation(context.Background(), scene, &buf, opts, anim); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	// The frames are shown every 100ms, and the last one is held for a second more.
+	anims, err := gif.DecodeAll(bytes.NewReader(render(GIF)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anims.Image) < 2 || len(anims.Image) != len(anims.Delay) {
+		t.Fatalf("got %d frames and %d delays", len(anims.Image), len(anims.Delay))
+	}
+	var total int
+	for i, delay := range anims.Delay {
+		if delay%10 != 0 {
+			t.Errorf("frame %d: got a delay of %d/100s, want a multiple of the frame interval", i, delay)
+		}
+		total += delay
+	}
+	if last := anims.Delay[len(anims.Delay)-1]; last < 110 {
+		t.Errorf("got a delay of %d/100s for the last frame, want the hold included", last)
+	}
+	// Every stroke takes two and a half frames, and the frames showing no change are merged.
+	if want := (len(rec.ops)*25+9)/10*10 + 100; total != want {
+		t.Errorf("the GIF animation lasts %d/100s, want %d/100s", total, want)
+	}
+
+	file := render(PNG)
+	chunks := readChunks(t, file)
+	if chunks[0].typ != "IHDR" || chunks[1].typ != "acTL" || chunks[2].typ != "IDAT" {
+		t.Fatalf("got the chunks %s %s %s, want IHDR acTL IDAT", chunks[0].typ, chunks[1].typ, chunks[2].typ)
+	}
+	if colorType := chunks[0].data[9]; colorType != 6 {
+		t.Errorf("got the color type %d, want RGBA", colorType)
+	}
+
+	var fcTL, fdAT int
+	var apngTotal time.Duration
+	seq := uint32(0)
+	for _, c := range chunks[3:] {
+		switch c.typ {
+		case "IDAT":
+			t.Error("the animation frames are stored in IDAT chunks")
+			continue
+		case "fcTL":
+			fcTL++
+			num, den := binary.BigEndian.Uint16(c.data[20:]), binary.BigEndian.Uint16(c.data[22:])
+			apngTotal += time.Duration(num) * time.Second / time.Duration(den)
+		case "fdAT":
+			fdAT++
+		default:
+			continue
+		}
+		if got := binary.BigEndian.Uint32(c.data); got != seq {
+			t.Errorf("%s: got the sequence number %d, want %d", c.typ, got, seq)
+		}
+		seq++
+	}
+	if frames := binary.BigEndian.Uint32(chunks[1].data); int(frames) != fcTL || fcTL != fdAT {
+		t.Errorf("acTL counts %d frames, got %d fcTL and %d fdAT chunks", frames, fcTL, fdAT)
+	}
+	if fcTL != len(anims.Image) {
+		t.Errorf("got %d APNG frames and %d GIF frames", fcTL, len(anims.Image))
+	}
+	if want := time.Duration(total) * 10 * time.Millisecond; apngTotal != want {
+		t.Errorf("the APNG animation lasts %v, the GIF one %v", apngTotal, want)
+	}
+
+	// The default image is the complete diagram, so it has as many drawn pixels as the last frame.
+	img, err := png.Decode(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if drawn(img) < drawn(composite(anims)) {
+		t.Errorf("the default image has %d drawn pixels, the complete animation %d", drawn(img), drawn(composite(anims)))
+	}
+}
+
+// composite returns the last image of the GIF animation.
+func composite(anims *gif.GIF) image.Image {
+	img := image.NewRGBA(anims.Image[0].Bounds())
+	for _, frame := range anims.Image {
+		for y := frame.Rect.Min.Y; y < frame.Rect.Max.Y; y++ {
+			for x := frame.Rect.Min.X; x < frame.Rect.Max.X; x++ {
+				img.Set(x, y, frame.At(x, y))
+			}
+		}
+	}
+	return img
+}
+
+// drawn returns the number of dark pixels of the image.
+func drawn(img image.Image) int {
+	var n int
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r+g+b < 3*0x8000 {
+				n++
+			}
+		}
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package canvas
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"io"
+	"time"
+)
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// apngFrame is an encoded frame of an animated PNG.
+type apngFrame struct {
+	rect  image.Rectangle
+	data  []byte // the compressed image data
+	delay time.Duration
+}
+
+// apngWriter encodes the frames as an animated PNG. All the frames are encoded as non-premultiplied
+// RGBA images, so they share the color type of the header, and are wrapped into the animation chunks
+// defined by the APNG specification.
+type apngWriter struct {
+	size   image.Point // the size of the first frame, which covers the whole animation
+	frames []apngFrame
+}
+
+func (a *apngWriter) add(img *image.RGBA, r image.Rectangle, delay time.Duration) error {
+	data, err := encodeNRGBA(img, r)
+	if err != nil {
+		return fmt.Errorf("error encoding the PNG frame: %w", err)
+	}
+	if len(a.frames) == 0 {
+		a.size = r.Size()
+	}
+	a.frames = append(a.frames, apngFrame{rect: r, data: data, delay: delay})
+	return nil
+}
+
+func (a *apngWriter) extend(delay time.Duration) {
+	if len(a.frames) > 0 {
+		a.frames[len(a.frames)-1].delay += delay
+	}
+}
+
+// encode writes the final image as the default image, shown by the viewers not supporting animations.
+// It's written before the first fcTL chunk, so it's not part of the animation.
+func (a *apngWriter) encode(w io.Writer, final *image.RGBA) error {
+	if len(a.frames) == 0 {
+		return errors.New("the animation has no frames")
+	}
+	still, err := encodeNRGBA(final, final.Bounds())
+	if err != nil {
+		return fmt.Errorf("error encoding the PNG animation: %w", err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(pngSignature)
+	// 8 bits per channel, truecolor with alpha, no interlacing.
+	writeChunk(&buf, "IHDR", append(be32(uint32(a.size.X), uint32(a.size.Y)), 8, 6, 0, 0, 0))
+	writeChunk(&buf, "acTL", be32(uint32(len(a.frames)), 0)) // loop forever
+	writeChunk(&buf, "IDAT", still)
+
+	var seq uint32
+	for _, f := range a.frames {
+		ms := min(f.delay.Milliseconds(), 0xffff)
+		ctl := be32(seq, uint32(f.rect.Dx()), uint32(f.rect.Dy()), uint32(f.rect.Min.X), uint32(f.rect.Min.Y))
+		ctl = binary.BigEndian.AppendUint16(ctl, uint16(ms))
+		ctl = binary.BigEndian.AppendUint16(ctl, 1000)
+		ctl = append(ctl, 0, 0) // keep the previous frames and overwrite the frame area
+		writeChunk(&buf, "fcTL", ctl)
+		writeChunk(&buf, "fdAT", append(be32(seq+1), f.data...))
+		seq += 2
+	}
+	writeChunk(&buf, "IEND", nil)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("error encoding the PNG animation: %w", err)
+	}
+	return nil
+}
+
+// encodeNRGBA returns the compressed PNG image data of the r area of the image, converted
+// to non-premultiplied RGBA. The rows are not filtered.
+func encodeNRGBA(img *image.RGBA, r image.Rectangle) ([]byte, error) {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, r.Min, draw.Src)
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	for y := 0; y < r.Dy(); y++ {
+		zw.Write([]byte{0})
+		zw.Write(nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+4*r.Dx()])
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeChunk writes a PNG chunk: its length, type, data and checksum.
+func writeChunk(buf *bytes.Buffer, typ string, data []byte) {
+	buf.Write(be32(uint32(len(data))))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	buf.WriteString(typ)
+	buf.Write(data)
+	buf.Write(be32(crc.Sum32()))
+}
+
+// be32 encodes the values as big endian 32-bit integers.
+func be32(values ...uint32) []byte {
+	b := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
@@ -0,0 +1,161 @@
+package canvas
+
+import (
+	"image"
+	"slices"
+)
+
+// boxIndex finds the boxes enclosing the areas of a scene, without going over all of its figures.
+// The Box and Shape figures are indexed by the rows they cover, and the straight lines by the row
+// or the column they lie on, so that the boxes drawn with four lines are found from the closest lines.
+type boxIndex struct {
+	// boxes holds the bounds of the Box and Shape figures covering each row.
+	boxes map[int][]image.Rectangle
+	// rows and cols hold the horizontal lines of each row and the vertical lines of each column.
+	rows, cols map[int]*lineRun
+	// minCol and maxCol hold the columns of the leftmost and of the rightmost vertical lines.
+	minCol, maxCol int
+}
+
+// lineRun holds the lines lying on the same row or column, sorted by their start.
+type lineRun struct {
+	spans []lineSpan
+	// reach holds the farthest end of the spans up to each index.
+	reach []int
+}
+
+// lineSpan is a line lying on a row or a column, from its start to its end along the axis.
+type lineSpan struct {
+	start, end int
+	// order holds the position of the line among the scene figures.
+	order int
+	line  *Line
+}
+
+// newBoxIndex indexes the boxes and the lines of the scene.
+func newBoxIndex(scene *Scene) *boxIndex {
+	ix := &boxIndex{
+		boxes: make(map[int][]image.Rectangle),
+		rows:  make(map[int]*lineRun),
+		cols:  make(map[int]*lineRun),
+	}
+	add := func(runs map[int]*lineRun, key int, span lineSpan) {
+		run, ok := runs[key]
+		if !ok {
+			run = new(lineRun)
+			runs[key] = run
+		}
+		run.spans = append(run.spans, span)
+	}
+	for i, fig := range scene.Figures {
+		switch fig := fig.(type) {
+		case *Box, *Shape:
+			b := fig.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				ix.boxes[y] = append(ix.boxes[y], b)
+			}
+		case *Line:
+			x0, x1 := min(fig.X0, fig.X1), max(fig.X0, fig.X1)
+			y0, y1 := min(fig.Y0, fig.Y1), max(fig.Y0, fig.Y1)
+			switch {
+			case y0 == y1 && x0 < x1:
+				add(ix.rows, y0, lineSpan{x0, x1, i, fig})
+			case x0 == x1 && y0 < y1:
+				if len(ix.cols) == 0 {
+					ix.minCol, ix.maxCol = x0, x0
+				}
+				ix.minCol, ix.maxCol = min(ix.minCol, x0), max(ix.maxCol, x0)
+				add(ix.cols, x0, lineSpan{y0, y1, i, fig})
+			}
+		}
+	}
+	for _, runs := range []map[int]*lineRun{ix.rows, ix.cols} {
+		for _, run := range runs {
+			slices.SortFunc(run.spans, func(a, b lineSpan) int { return a.start - b.start })
+			run.reach = make([]int, len(run.spans))
+			for i, span := range run.spans {
+				run.reach[i] = span.end
+				if i > 0 {
+					run.reach[i] = max(run.reach[i], run.reach[i-1])
+				}
+			}
+		}
+	}
+	return ix
+}
+
+// covering returns the first line of the scene starting before start and reaching at least end, or nil.
+// The spans starting before start are visited from the last one, as long as one of them can reach end.
+func (run *lineRun) covering(start, end int) *Line {
+	if run == nil {
+		return nil
+	}
+	i, _ := slices.BinarySearchFunc(run.spans, start, func(span lineSpan, start int) int { return span.start - start })
+	var found *lineSpan
+	for i--; i >= 0 && run.reach[i] >= end; i-- {
+		if span := &run.spans[i]; span.end >= end && (found == nil || span.order < found.order) {
+			found = span
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return found.line
+}
+
+// enclosing returns the smallest box or shape containing the area, or the box made
+// of the lines closest to the area on each side.
+func (ix *boxIndex) enclosing(r image.Rectangle) (image.Rectangle, bool) {
+	var found image.Rectangle
+	for _, b := range ix.boxes[r.Min.Y] {
+		if r.In(b.Inset(1)) && (found.Empty() || b.Dx()*b.Dy() < found.Dx()*found.Dy()) {
+			found = b
+		}
+	}
+	if box, ok := ix.around(r); ok && (found.Empty() || box.In(found)) {
+		return box, true
+	}
+	return found, !found.Empty()
+}
+
+// around returns the box made of the lines closest to the area on each side.
+func (ix *boxIndex) around(r image.Rectangle) (image.Rectangle, bool) {
+	// The vertical sides are looked up first, as the horizontal sides have to lie between their ends.
+	var left, right *Line
+	for x := r.Min.X - 1; left == nil && x >= ix.minCol; x-- {
+		left = ix.cols[x].covering(r.Min.Y, r.Max.Y)
+	}
+	for x := r.Max.X; right == nil && x <= ix.maxCol; x++ {
+		right = ix.cols[x].covering(r.Min.Y, r.Max.Y)
+	}
+	if left == nil || right == nil {
+		return image.Rectangle{}, false
+	}
+	y0 := max(min(left.Y0, left.Y1), min(right.Y0, right.Y1))
+	y1 := min(max(left.Y0, left.Y1), max(right.Y0, right.Y1))
+
+	var top, bottom *Line
+	for y := r.Min.Y - 1; top == nil && y >= y0; y-- {
+		top = ix.rows[y].covering(r.Min.X, r.Max.X)
+	}
+	for y := r.Max.Y; bottom == nil && y <= y1; y++ {
+		bottom = ix.rows[y].covering(r.Min.X, r.Max.X)
+	}
+	if top == nil || bottom == nil {
+		return image.Rectangle{}, false
+	}
+
+	// The sides have to meet in the corners.
+	box := image.Rect(left.X0, top.Y0, right.X0+1, bottom.Y0+1)
+	for _, side := range []*Line{top, bottom} {
+		if min(side.X0, side.X1) > box.Min.X || max(side.X0, side.X1) < box.Max.X-1 {
+			return image.Rectangle{}, false
+		}
+	}
+	for _, side := range []*Line{left, right} {
+		if min(side.Y0, side.Y1) > box.Min.Y || max(side.Y0, side.Y1) < box.Max.Y-1 {
+			return image.Rectangle{}, false
+		}
+	}
+	return box, true
+}
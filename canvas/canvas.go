@@ -7,15 +7,27 @@ package canvas
 import (
 	"math"
 	"math/rand"
+	"time"
 
 	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
 )
 
 // Canvas defines the canvas basic elements.
 type Canvas struct {
 	*gg.Context
-	font      string
+	fonts     *FontSet
+	faces     map[faceKey]font.Face
 	lineWidth float64
+	scale     float64
+	theme     Theme
+	rnd       *rand.Rand
+
+	// The pen position, updated by moveTo and lineTo.
+	penX, penY float64
+
+	// rec records the drawing operations, if not nil.
+	rec *recorder
 }
 
 // Drawer interface defines the Canvas drawing method.
@@ -28,25 +40,50 @@ type Drawer interface {
 const CellSize float64 = 20
 
 // NewCanvas is a constructor method, which instantiates a new Canvas element.
-func NewCanvas(ctx *gg.Context, font string, lineWidth float64) *Canvas {
-	if err := ctx.LoadFontFace(font, 20); err != nil {
-		panic(err)
-	}
+func NewCanvas(ctx *gg.Context, fonts *FontSet, lineWidth float64) *Canvas {
 	ctx.SetLineWidth(lineWidth)
-	return &Canvas{ctx, font, lineWidth}
+	return &Canvas{
+		Context:   ctx,
+		fonts:     fonts,
+		faces:     make(map[faceKey]font.Face),
+		lineWidth: lineWidth,
+		scale:     1,
+		theme:     DefaultTheme,
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// setColor sets the drawing color, translating the parser's default colors to the canvas theme.
+func (ctx *Canvas) setColor(color string) {
+	switch color {
+	case "", "#000":
+		color = ctx.theme.Foreground
+	case "#666":
+		color = ctx.theme.Muted
+	}
+	ctx.SetHexColor(color)
+	if ctx.rec != nil {
+		ctx.rec.color = color
+	}
 }
 
-var _x0, _y0 float64
+// stroke strokes the current path.
+func (ctx *Canvas) stroke() {
+	ctx.Stroke()
+	if ctx.rec != nil {
+		ctx.rec.stroke(ctx.lineWidth)
+	}
+}
 
 // moveTo move the pointer to (x0,y0) position
 func (ctx *Canvas) moveTo(x0, y0 float64) {
-	_x0 = x0
-	_y0 = y0
+	ctx.penX = x0
+	ctx.penY = y0
 }
 
 // lineTo move the pointer to (x1,y1) position
 func (ctx *Canvas) lineTo(x1, y1 float64) {
-	ctx.shakyLine(_x0, _y0, x1, y1)
+	ctx.shakyLine(ctx.penX, ctx.penY, x1, y1)
 	ctx.moveTo(x1, y1)
 }
 
@@ -61,10 +98,10 @@ func (ctx *Canvas) shakyLine(x0, y0, x1, y1 float64) {
 
 	// Pick two random points that are placed on different sides of the line that passes through.
 	K := math.Sqrt(l) / 1.5
-	k1 = rand.Float64()
-	k2 = rand.Float64()
-	l3 = rand.Float64() * K
-	l4 = rand.Float64() * K
+	k1 = ctx.rnd.Float64()
+	k2 = ctx.rnd.Float64()
+	l3 = ctx.rnd.Float64() * K
+	l4 = ctx.rnd.Float64() * K
 
 	// Pick a random point on the line between P0 and P1.
 	x3 = x0 + dx*k1 + dy/l*l3
@@ -77,22 +114,139 @@ func (ctx *Canvas) shakyLine(x0, y0, x1, y1 float64) {
 	// Draw a bezier curve through the four selected points.
 	ctx.MoveTo(x0, y0)
 	ctx.CubicTo(x3, y3, x4, y4, x1, y1)
+	if ctx.rec != nil {
+		ctx.rec.path = append(ctx.rec.path, cubic{x0, y0, x3, y3, x4, y4, x1, y1})
+	}
+}
+
+// dashedLine draws a line between (x0, y0) and (x1, y1) made of short shaky dashes.
+func (ctx *Canvas) dashedLine(x0, y0, x1, y1 float64) {
+	const dash, gap = CellSize / 2, CellSize / 4
+
+	l := math.Hypot(x1-x0, y1-y0)
+	if l == 0 {
+		return
+	}
+	dx, dy := (x1-x0)/l, (y1-y0)/l
+	for d := 0.0; d < l; d += dash + gap {
+		e := min(d+dash, l)
+		ctx.moveTo(x0+dx*d, y0+dy*d)
+		ctx.lineTo(x0+dx*e, y0+dy*e)
+	}
+}
+
+// curveTo draws a shaky cubic Bézier curve from the pen position to (x3, y3),
+// moving the control points by a small random amount.
+func (ctx *Canvas) curveTo(x1, y1, x2, y2, x3, y3 float64) {
+	fuzz := func() float64 { return (ctx.rnd.Float64()*2 - 1) * 1.5 }
+	x1, y1 = x1+fuzz(), y1+fuzz()
+	x2, y2 = x2+fuzz(), y2+fuzz()
+
+	ctx.MoveTo(ctx.penX, ctx.penY)
+	ctx.CubicTo(x1, y1, x2, y2, x3, y3)
+	if ctx.rec != nil {
+		ctx.rec.path = append(ctx.rec.path, cubic{ctx.penX, ctx.penY, x1, y1, x2, y2, x3, y3})
+	}
+	ctx.moveTo(x3, y3)
+}
+
+// ellipse draws a shaky elliptical arc centered at (cx, cy), from the angle a0 to the angle a1.
+// The arc is approximated by cubic curves spanning at most a quarter of the ellipse each.
+func (ctx *Canvas) ellipse(cx, cy, rx, ry, a0, a1 float64) {
+	curves := arc(cx, cy, rx, ry, a0, a1)
+	ctx.moveTo(curves[0].x0, curves[0].y0)
+	for _, c := range curves {
+		ctx.curveTo(c.x1, c.y1, c.x2, c.y2, c.x3, c.y3)
+	}
+}
+
+// arc returns the cubic curves approximating the elliptical arc centered at (cx, cy),
+// from the angle a0 to the angle a1.
+func arc(cx, cy, rx, ry, a0, a1 float64) []cubic {
+	n := max(1, int(math.Ceil(math.Abs(a1-a0)/(math.Pi/2))))
+	step := (a1 - a0) / float64(n)
+	k := 4.0 / 3 * math.Tan(step/4)
+
+	curves := make([]cubic, n)
+	for i := range curves {
+		a, b := a0+float64(i)*step, a0+float64(i+1)*step
+		curves[i] = cubic{
+			cx + rx*math.Cos(a), cy + ry*math.Sin(a),
+			cx + rx*(math.Cos(a)-k*math.Sin(a)), cy + ry*(math.Sin(a)+k*math.Cos(a)),
+			cx + rx*(math.Cos(b)+k*math.Sin(b)), cy + ry*(math.Sin(b)-k*math.Cos(b)),
+			cx + rx*math.Cos(b), cy + ry*math.Sin(b),
+		}
+	}
+	return curves
+}
+
+// polygon returns the closed outline going through the points, given as x, y pairs.
+func polygon(points ...float64) []cubic {
+	var curves []cubic
+	for i := 0; i < len(points); i += 2 {
+		x0, y0 := points[i], points[i+1]
+		x1, y1 := points[(i+2)%len(points)], points[(i+3)%len(points)]
+		curves = append(curves, cubic{x0, y0, x0 + (x1-x0)/3, y0 + (y1-y0)/3, x1 - (x1-x0)/3, y1 - (y1-y0)/3, x1, y1})
+	}
+	return curves
+}
+
+// roundedRect returns the outline of the rectangle having its corners rounded with the radius r.
+func roundedRect(x0, y0, x1, y1, r float64) []cubic {
+	if r <= 0 {
+		return polygon(x0, y0, x1, y0, x1, y1, x0, y1)
+	}
+	var curves []cubic
+	corners := []struct{ x, y, a float64 }{
+		{x1 - r, y0 + r, -math.Pi / 2},
+		{x1 - r, y1 - r, 0},
+		{x0 + r, y1 - r, math.Pi / 2},
+		{x0 + r, y0 + r, math.Pi},
+	}
+	for i, c := range corners {
+		curves = append(curves, arc(c.x, c.y, r, r, c.a, c.a+math.Pi/2)...)
+		next := corners[(i+1)%len(corners)]
+		side := polygon(c.x+r*math.Cos(c.a+math.Pi/2), c.y+r*math.Sin(c.a+math.Pi/2),
+			next.x+r*math.Cos(next.a), next.y+r*math.Sin(next.a))
+		curves = append(curves, side[0])
+	}
+	return curves
+}
+
+// fill fills the closed outline made of the curves with the current color. The outline
+// is not shaken, as the strokes drawn over it already are.
+func (ctx *Canvas) fill(curves []cubic) {
+	if len(curves) == 0 {
+		return
+	}
+	ctx.MoveTo(curves[0].x0, curves[0].y0)
+	for _, c := range curves {
+		ctx.CubicTo(c.x1, c.y1, c.x2, c.y2, c.x3, c.y3)
+	}
+	ctx.ClosePath()
+	ctx.Fill()
+	if ctx.rec != nil {
+		ctx.rec.fill(curves)
+	}
 }
 
 // bulb draws a shaky bulb (used for line endings).
 func (ctx *Canvas) bulb(x0, y0 float64) {
-	fuzziness := rand.Float64()*2 - 1
+	fuzziness := ctx.rnd.Float64()*2 - 1
 
 	for i := 0; i < 3; i++ {
 		ctx.DrawArc(x0+fuzziness, y0+fuzziness, 5, 0, math.Pi*2)
 		ctx.ClosePath()
 		ctx.Fill()
 	}
+	if ctx.rec != nil {
+		ctx.rec.dot(x0+fuzziness, y0+fuzziness, 5)
+	}
 }
 
 // arrowHead draws a shaky arrowhead at the (x1, y1) as an ending
-// for the line from (x0, y0) to (x1, y1).
-func (ctx *Canvas) arrowHead(x0, y0, x1, y1 float64) {
+// for the line from (x0, y0) to (x1, y1). The closed arrowheads are triangles.
+func (ctx *Canvas) arrowHead(x0, y0, x1, y1 float64, closed bool) {
 	dx := x0 - x1
 	dy := y0 - y1
 
@@ -114,7 +268,7 @@ func (ctx *Canvas) arrowHead(x0, y0, x1, y1 float64) {
 
 	ctx.moveTo(x3, y3)
 	ctx.lineTo(x1, y1)
-	ctx.Stroke()
+	ctx.stroke()
 
 	l4 := float64(20.0)
 	x4 := x1 + l4*math.Cos(alpha4)
@@ -122,42 +276,105 @@ func (ctx *Canvas) arrowHead(x0, y0, x1, y1 float64) {
 
 	ctx.moveTo(x4, y4)
 	ctx.lineTo(x1, y1)
-	ctx.Stroke()
+	if closed {
+		ctx.lineTo(x3, y3)
+	}
+	ctx.stroke()
 }
 
-// fillText fill out the text.
-func (ctx *Canvas) fillText(text string, x0, y0 float64) {
-	ctx.DrawString(text, x0, y0)
+// fillText fill out the text using the font of the given style.
+// The glyphs missing from the style's font are rendered with one of the fallback fonts.
+func (ctx *Canvas) fillText(text string, style FontStyle, x0, y0 float64) {
+	for _, run := range ctx.fonts.runs(style, text) {
+		face := ctx.face(run.font, style)
+		ctx.SetFontFace(face)
+		ctx.DrawString(run.text, x0, y0)
+		if ctx.rec != nil {
+			ctx.rec.text(run.font, face, fontSizes[style], run.text, x0, y0)
+		}
+
+		w, _ := ctx.MeasureString(run.text)
+		x0 += w
+	}
 }
 
 // Draw draws the text annotation at (x0, y0) with the given color.
 func (text *Text) Draw(ctx *Canvas) {
-	ctx.SetHexColor(text.color)
-	ctx.fillText(text.text, X(float64(text.x0)), Y(float64(text.y0)+0.5))
+	ctx.setColor(text.Color)
+	ctx.fillText(text.Text, text.Style, X(float64(text.X)), Y(float64(text.Y)+0.5))
 }
 
 // Draw draws a line from (x0, y0) to (x1, y1) with the given color.
 func (line *Line) Draw(ctx *Canvas) {
-	ctx.SetHexColor(line.color)
-	ctx.SetLineWidth(ctx.lineWidth)
-	ctx.moveTo(X(float64(line.x0)), Y(float64(line.y0)))
-	ctx.lineTo(X(float64(line.x1)), Y(float64(line.y1)))
-	ctx.Stroke()
+	ctx.setColor(line.Color)
+	// The line width is not affected by the context transformation matrix, so it needs to be scaled explicitly.
+	ctx.SetLineWidth(ctx.lineWidth * ctx.scale)
+	if line.Dashed {
+		ctx.dashedLine(X(float64(line.X0)), Y(float64(line.Y0)), X(float64(line.X1)), Y(float64(line.Y1)))
+	} else {
+		ctx.moveTo(X(float64(line.X0)), Y(float64(line.Y0)))
+		ctx.lineTo(X(float64(line.X1)), Y(float64(line.Y1)))
+	}
+	ctx.stroke()
 
 	// Draw given type of ending on the (x1, y1).
-	_ending := func(ctx *Canvas, typ string, x0, y0, x1, y1 float64) {
+	_ending := func(ctx *Canvas, typ Ending, x0, y0, x1, y1 float64) {
 		switch typ {
-		case "circle":
+		case Circle:
 			ctx.bulb(x1, y1)
 			return
-		case "arrow":
-			ctx.arrowHead(x0, y0, x1, y1)
+		case Arrow:
+			ctx.arrowHead(x0, y0, x1, y1, false)
+			return
+		case Triangle:
+			ctx.arrowHead(x0, y0, x1, y1, true)
 			return
 		}
 	}
 
-	_ending(ctx, line.start, X(float64(line.x1)), Y(float64(line.y1)), X(float64(line.x0)), Y(float64(line.y0)))
-	_ending(ctx, line.end, X(float64(line.x0)), Y(float64(line.y0)), X(float64(line.x1)), Y(float64(line.y1)))
+	_ending(ctx, line.Start, X(float64(line.X1)), Y(float64(line.Y1)), X(float64(line.X0)), Y(float64(line.Y0)))
+	_ending(ctx, line.End, X(float64(line.X0)), Y(float64(line.Y0)), X(float64(line.X1)), Y(float64(line.Y1)))
+}
+
+// Draw draws the box edges as four separate shaky lines with the given color,
+// over the area filled with the fill color.
+func (box *Box) Draw(ctx *Canvas) {
+	x0, y0 := X(float64(box.X0)), Y(float64(box.Y0))
+	x1, y1 := X(float64(box.X1)), Y(float64(box.Y1))
+	var r float64
+	if box.Rounded {
+		r = min(CellSize/2, (x1-x0)/2, (y1-y0)/2)
+	}
+
+	if box.Fill != "" {
+		ctx.setColor(box.Fill)
+		ctx.fill(roundedRect(x0, y0, x1, y1, r))
+	}
+	ctx.setColor(box.Color)
+	ctx.SetLineWidth(ctx.lineWidth * ctx.scale)
+
+	edge := func(xa, ya, xb, yb float64) {
+		if box.Dashed {
+			ctx.dashedLine(xa, ya, xb, yb)
+		} else {
+			ctx.moveTo(xa, ya)
+			ctx.lineTo(xb, yb)
+		}
+	}
+	corner := func(cx, cy, a float64) {
+		if r > 0 {
+			ctx.ellipse(cx, cy, r, r, a, a+math.Pi/2)
+		}
+	}
+	edge(x0+r, y0, x1-r, y0)
+	corner(x1-r, y0+r, -math.Pi/2)
+	edge(x1, y0+r, x1, y1-r)
+	corner(x1-r, y1-r, 0)
+	edge(x1-r, y1, x0+r, y1)
+	corner(x0+r, y1-r, math.Pi/2)
+	edge(x0, y1-r, x0, y0+r)
+	corner(x0+r, y0+r, math.Pi)
+	ctx.stroke()
 }
 
 // X returns the symbols x position.
@@ -0,0 +1,102 @@
+package canvas
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultTitle is the title of the diagrams having no heading.
+const DefaultTitle = "Diagram"
+
+// shapeNames holds the names of the shapes used in the descriptions.
+var shapeNames = map[ShapeType]string{
+	Database:    "database",
+	Cloud:       "cloud",
+	Actor:       "actor",
+	Document:    "document",
+	Diamond:     "decision",
+	InputOutput: "input/output",
+	Ellipse:     "ellipse",
+}
+
+// Title returns the title of the diagram: its first heading label, or DefaultTitle.
+func Title(scene *Scene) string {
+	for _, fig := range scene.Figures {
+		if text, ok := fig.(*Text); ok && text.Style == HeadingFont {
+			return text.Text
+		}
+	}
+	return DefaultTitle
+}
+
+// Describe returns the text description of the diagram, meant as the alternative text of
+// the image for the screen readers. It lists the boxes with their labels, the connections
+// between them following the arrowheads, and the rest of the labels.
+func Describe(scene *Scene) string {
+	g := NewGraph(scene)
+	title := Title(scene)
+
+	name := func(i int) string {
+		node := g.Nodes[i]
+		switch {
+		case node.Shape != "" && node.Label != "":
+			return "the " + shapeNames[node.Shape] + " " + strconv.Quote(node.Label)
+		case node.Shape != "":
+			return "an unlabeled " + shapeNames[node.Shape]
+		case node.Label != "":
+			return strconv.Quote(node.Label)
+		case node.Box:
+			return "an unlabeled box"
+		}
+		return "a label"
+	}
+
+	var sb strings.Builder
+	sb.WriteString(title + ".\n")
+
+	var boxes []string
+	for i, node := range g.Nodes {
+		if node.Box {
+			boxes = append(boxes, name(i))
+		}
+	}
+	switch len(boxes) {
+	case 0:
+	case 1:
+		fmt.Fprintf(&sb, "The diagram has one box: %s.\n", boxes[0])
+	default:
+		fmt.Fprintf(&sb, "The diagram has %d boxes: %s.\n", len(boxes), strings.Join(boxes, ", "))
+	}
+
+	for _, e := range g.Edges {
+		switch e.Direction {
+		case Forward:
+			fmt.Fprintf(&sb, "An arrow points from %s to %s.\n", name(e.From), name(e.To))
+		case Both:
+			fmt.Fprintf(&sb, "%s and %s point to each other.\n", upper(name(e.From)), name(e.To))
+		default:
+			fmt.Fprintf(&sb, "A line connects %s and %s.\n", name(e.From), name(e.To))
+		}
+	}
+
+	var labels []string
+	for _, text := range g.Labels {
+		if text.Style == HeadingFont && text.Text == title {
+			continue
+		}
+		labels = append(labels, strconv.Quote(text.Text))
+	}
+	if len(labels) > 0 {
+		fmt.Fprintf(&sb, "Labels: %s.\n", strings.Join(labels, ", "))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// upper capitalizes the first letter of the sentence.
+func upper(s string) string {
+	if s != "" && 'a' <= s[0] && s[0] <= 'z' {
+		return string(s[0]-'a'+'A') + s[1:]
+	}
+	return s
+}
@@ -0,0 +1,258 @@
+package canvas
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"unicode/utf8"
+)
+
+// DiagnosticCode identifies the kind of problem found by the parser.
+type DiagnosticCode string
+
+// The problems reported by the parser.
+const (
+	DanglingEnding   DiagnosticCode = "dangling-ending"
+	OrphanCorner     DiagnosticCode = "orphan-corner"
+	LineGap          DiagnosticCode = "line-gap"
+	OverlappingLabel DiagnosticCode = "overlapping-label"
+	MisalignedEdge   DiagnosticCode = "misaligned-edge"
+	UndefinedLink    DiagnosticCode = "undefined-link"
+	UnsafeLink       DiagnosticCode = "unsafe-link"
+)
+
+// Diagnostic is a warning about a suspicious construct found in the ASCII art.
+// The characters involved are still rendered, usually as text.
+type Diagnostic struct {
+	Pos     Position       `json:"pos"`
+	Code    DiagnosticCode `json:"code"`
+	Message string         `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Code)
+}
+
+// newDiagnostic returns a diagnostic for the (x, y) cell of the ASCII grid.
+func newDiagnostic(x, y int, code DiagnosticCode, format string, args ...any) Diagnostic {
+	return Diagnostic{
+		Pos:     Position{Line: y + 1, Column: x + 1},
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// checkLeftovers reports the line characters which were not consumed by any of the extracted lines.
+// It should be called after the line extraction and before the text extraction.
+// The characters meant as text, defined by the kinds, are not reported.
+func checkLeftovers(data [][]rune, kinds [][]cellKind) []Diagnostic {
+	var diags []Diagnostic
+
+	isBlank := func(y, x int) bool {
+		return x < 0 || x >= len(data[y]) || data[y][x] == ' '
+	}
+
+	for y := range data {
+		for x, c := range data[y] {
+			if kinds[y][x] != plainCell {
+				continue
+			}
+			switch c {
+			case '+':
+				diags = append(diags, newDiagnostic(x, y, OrphanCorner, "corner %q does not join any line", string(c)))
+			case '<', '>', '^', 'v', '*':
+				// Only the standalone symbols are reported, otherwise they are part of a label.
+				if isBlank(y, x-1) && isBlank(y, x+1) {
+					diags = append(diags, newDiagnostic(x, y, DanglingEnding, "line ending %q does not touch any line", string(c)))
+				}
+			}
+		}
+	}
+	return diags
+}
+
+// checkGaps reports the collinear lines which are separated by a single space,
+// which usually denotes a broken line. The lines should have their original
+// coordinates, before the adjustment of the arrow endings.
+func checkGaps(src [][]rune, lines []Line) []Diagnostic {
+	var diags []Diagnostic
+
+	at := func(y, x int) rune {
+		if 0 <= y && y < len(src) && 0 <= x && x < len(src[y]) {
+			return src[y][x]
+		}
+		return 0
+	}
+	isHorizontal := func(c rune) bool { return c == '-' || c == '~' }
+	isVertical := func(c rune) bool { return c == '|' || c == '!' }
+
+	// Index the lines by their start, to look up the lines following a gap.
+	starts := make(map[Point][]int)
+	for i, l := range lines {
+		p := Point{l.X0, l.Y0}
+		starts[p] = append(starts[p], i)
+	}
+
+	for i, l1 := range lines {
+		if l1.Y0 == l1.Y1 && at(l1.Y1, l1.X1+1) == ' ' {
+			for _, j := range starts[Point{l1.X1 + 2, l1.Y1}] {
+				l2 := lines[j]
+				if i != j && l2.Y0 == l2.Y1 && isHorizontal(at(l1.Y1, l1.X1)) && isHorizontal(at(l2.Y0, l2.X0)) {
+					diags = append(diags, newDiagnostic(l1.X1+1, l1.Y1, LineGap, "line is broken by a gap"))
+				}
+			}
+		}
+		if l1.X0 == l1.X1 && at(l1.Y1+1, l1.X1) == ' ' {
+			for _, j := range starts[Point{l1.X1, l1.Y1 + 2}] {
+				l2 := lines[j]
+				if i != j && l2.X0 == l2.X1 && isVertical(at(l1.Y1, l1.X1)) && isVertical(at(l2.Y0, l2.X0)) {
+					diags = append(diags, newDiagnostic(l1.X1, l1.Y1+1, LineGap, "line is broken by a gap"))
+				}
+			}
+		}
+	}
+	return diags
+}
+
+// checkCorners reports the perpendicular lines whose undecorated ends are diagonally adjacent,
+// like the ragged box edges which miss their corner by one column or row. The ends lying on
+// a perpendicular line already form a corner or a junction, so they are not reported.
+// The lines should have their original coordinates, before the adjustment of the arrow endings.
+func checkCorners(lines []Line) []Diagnostic {
+	var diags []Diagnostic
+
+	// Mark the cells covered by the horizontal and by the vertical lines.
+	const horizontal, vertical = 1, 2
+	var width, height int
+	for _, l := range lines {
+		width = max(width, l.X0+1, l.X1+1)
+		height = max(height, l.Y0+1, l.Y1+1)
+	}
+	covered := make([]uint8, width*height)
+	for _, l := range lines {
+		switch {
+		case l.Y0 == l.Y1 && l.X0 != l.X1:
+			for x := min(l.X0, l.X1); x <= max(l.X0, l.X1); x++ {
+				covered[l.Y0*width+x] |= horizontal
+			}
+		case l.X0 == l.X1 && l.Y0 != l.Y1:
+			for y := min(l.Y0, l.Y1); y <= max(l.Y0, l.Y1); y++ {
+				covered[y*width+l.X0] |= vertical
+			}
+		}
+	}
+
+	// Index the free ends of the horizontal lines by their position.
+	type end struct {
+		line int
+		p    Point
+	}
+	ends := make(map[Point][]end)
+	for j, l := range lines {
+		if l.Y0 != l.Y1 || l.X0 == l.X1 {
+			continue
+		}
+		for _, p := range l.freeEnds() {
+			if covered[p.y*width+p.x]&vertical == 0 {
+				ends[p] = append(ends[p], end{j, p})
+			}
+		}
+	}
+
+	for i, l1 := range lines {
+		if l1.X0 != l1.X1 {
+			continue
+		}
+		for _, p1 := range l1.freeEnds() {
+			if covered[p1.y*width+p1.x]&horizontal != 0 {
+				continue
+			}
+			var found []end
+			for _, d := range []Point{{-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+				for _, e := range ends[Point{p1.x + d.x, p1.y + d.y}] {
+					if e.line != i {
+						found = append(found, e)
+					}
+				}
+			}
+			// Report the ends in the order of their lines.
+			slices.SortStableFunc(found, func(a, b end) int { return a.line - b.line })
+			for _, e := range found {
+				diags = append(diags, newDiagnostic(p1.x, p1.y, MisalignedEdge,
+					"line end is not aligned with the line ending at %d:%d", e.p.y+1, e.p.x+1))
+			}
+		}
+	}
+	return diags
+}
+
+// freeEnds returns the line ends without decoration.
+func (line *Line) freeEnds() []Point {
+	var ends []Point
+	if line.Start == NoEnding {
+		ends = append(ends, Point{line.X0, line.Y0})
+	}
+	if line.End == NoEnding && (line.X0 != line.X1 || line.Y0 != line.Y1) {
+		ends = append(ends, Point{line.X1, line.Y1})
+	}
+	return ends
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// checkLabels reports the labels which are estimated to overlap the neighbouring figures placed on
+// the same row, either because their larger font extends them, or because they were moved, like the
+// centered labels of the sequence diagrams. The labels placed inside a box or a shape overlap only its edges.
+func checkLabels(figures []Figure) []Diagnostic {
+	var diags []Diagnostic
+
+	// Index the figures by the rows they cover.
+	rows := make(map[int][]Figure)
+	for _, fig := range figures {
+		r := fig.Bounds()
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			rows[y] = append(rows[y], fig)
+		}
+	}
+
+	for _, fig := range figures {
+		text, ok := fig.(*Text)
+		if !ok {
+			continue
+		}
+		n := utf8.RuneCountInString(text.Text)
+		width := max(n, int(math.Ceil(float64(n)*fontSizes[text.Style]/fontSizes[BodyFont])))
+		extent := image.Rect(text.X, text.Y, text.X+width, text.Y+1)
+
+		for _, other := range rows[text.Y] {
+			if other == fig {
+				continue
+			}
+			areas := []image.Rectangle{other.Bounds()}
+			switch other.(type) {
+			case *Box, *Shape:
+				if r := areas[0]; text.Bounds().In(r) {
+					areas = []image.Rectangle{
+						image.Rect(r.Min.X, r.Min.Y, r.Min.X+1, r.Max.Y),
+						image.Rect(r.Max.X-1, r.Min.Y, r.Max.X, r.Max.Y),
+					}
+				}
+			}
+			if slices.ContainsFunc(areas, extent.Overlaps) {
+				diags = append(diags, Diagnostic{
+					Pos:     text.Pos,
+					Code:    OverlappingLabel,
+					Message: fmt.Sprintf("label %q overlaps the neighbouring figures", text.Text),
+				})
+				break
+			}
+		}
+	}
+	return diags
+}
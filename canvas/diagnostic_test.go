@@ -0,0 +1,203 @@
+package canvas
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCheckCorners(t *testing.T) {
+	tests := []struct {
+		name   string
+		compat Compat
+		src    string
+		want   []Position
+	}{
+		{
+			name: "box with arrow",
+			src: "+-----+\n" +
+				"| API |--->  x\n" +
+				"+-----+\n",
+		},
+		{
+			name: "arrow between boxes",
+			src: "+---+     +---+\n" +
+				"| a |---->| b |\n" +
+				"+---+     +---+\n",
+		},
+		{
+			name: "line leaving the bottom edge",
+			src: "+---+\n" +
+				"| a |\n" +
+				"+-+-+\n" +
+				"  |\n" +
+				"  v\n",
+		},
+		{
+			name:   "ditaa rounded box with arrow",
+			compat: Ditaa,
+			src: "/-----\\\n" +
+				"| API |==>  x\n" +
+				"\\-----/\n",
+		},
+		{
+			name: "ragged right edge",
+			src: "+-----+\n" +
+				"|     |\n" +
+				"+----+\n",
+			want: []Position{{Line: 2, Column: 7}},
+		},
+		{
+			name: "ragged bottom edge",
+			src: "+-----+\n" +
+				"|     |\n" +
+				"|     +\n" +
+				" +----+\n",
+			want: []Position{{Line: 3, Column: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &Diagram{Compat: tt.compat}
+			_, diags := d.Parse(tt.src)
+
+			var got []Position
+			for _, diag := range diags {
+				if diag.Code == MisalignedEdge {
+					got = append(got, diag.Pos)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("misaligned edges at %v, want %v\n%s", got, tt.want, diags)
+			}
+		})
+	}
+}
+
+// diagnosed returns the positions of the diagnostics having the code.
+func diagnosed(diags []Diagnostic, code DiagnosticCode) []Position {
+	var got []Position
+	for _, diag := range diags {
+		if diag.Code == code {
+			got = append(got, diag.Pos)
+		}
+	}
+	return got
+}
+
+func TestCheckLeftovers(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		code DiagnosticCode
+		want []Position
+	}{
+		{name: "orphan corner", src: "a  +  b", code: OrphanCorner, want: []Position{{Line: 1, Column: 4}}},
+		{name: "corner of a line", src: "+---", code: OrphanCorner},
+		{name: "dangling ending", src: "a\n\n  >  b", code: DanglingEnding, want: []Position{{Line: 3, Column: 3}}},
+		{name: "ending in a label", src: "a>b x*y", code: DanglingEnding},
+		{name: "ending of a line", src: "--->", code: DanglingEnding},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := (&Diagram{}).Parse(tt.src)
+			if got := diagnosed(diags, tt.code); !slices.Equal(got, tt.want) {
+				t.Errorf("got %s at %v, want %v\n%s", tt.code, got, tt.want, diags)
+			}
+		})
+	}
+}
+
+func TestCheckGaps(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []Position
+	}{
+		{name: "horizontal gap", src: "+--- ---+", want: []Position{{Line: 1, Column: 5}}},
+		{name: "vertical gap", src: "|\n|\n \n|\n|", want: []Position{{Line: 3, Column: 1}}},
+		{name: "wide gap", src: "---  ---"},
+		{name: "label between lines", src: "--- a ---"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := (&Diagram{}).Parse(tt.src)
+			if got := diagnosed(diags, LineGap); !slices.Equal(got, tt.want) {
+				t.Errorf("got gaps at %v, want %v\n%s", got, tt.want, diags)
+			}
+		})
+	}
+}
+
+func TestCheckLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		mode Mode
+		src  string
+		want []Position
+	}{
+		{
+			name: "body labels",
+			src: "+-----+ +---+\n" +
+				"| api |-| b |\n" +
+				"+-----+ +---+\n",
+		},
+		{
+			name: "heading overflowing the box",
+			src: "+-----------+ +---+\n" +
+				"| # Heading | | b |\n" +
+				"+-----------+ +---+\n",
+			want: []Position{{Line: 2, Column: 3}},
+		},
+		{
+			name: "heading with room",
+			src: "+--------------------+\n" +
+				"| # Heading          |\n" +
+				"+--------------------+\n",
+		},
+		{
+			name: "mono label",
+			src:  "`code`---",
+		},
+		{
+			name: "label next to a message",
+			mode: SequenceMode,
+			src: "+---+  +---+\n" +
+				"| a |  | b |\n" +
+				"+---+  +---+\n" +
+				"  |      |\n" +
+				"  |--------> very long label\n" +
+				"  |      |\n",
+		},
+		{
+			name: "label in the middle of a message",
+			mode: SequenceMode,
+			src: "+---+  +---+\n" +
+				"| a |  | b |\n" +
+				"+---+  +---+\n" +
+				"  |      |\n" +
+				"  |-long->|\n" +
+				"  |      |\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := (&Diagram{Mode: tt.mode}).Parse(tt.src)
+			if got := diagnosed(diags, OverlappingLabel); !slices.Equal(got, tt.want) {
+				t.Errorf("got overlapping labels at %v, want %v\n%s", got, tt.want, diags)
+			}
+		})
+	}
+
+	// The labels of the scenes built by hand can overlap each other or the box edges.
+	figures := []Figure{
+		&Box{X0: 0, Y0: 0, X1: 6, Y1: 2},
+		&Text{X: 1, Y: 1, Text: "abc", Pos: Position{Line: 2, Column: 2}},
+		&Text{X: 3, Y: 1, Text: "defg", Pos: Position{Line: 2, Column: 4}},
+		&Text{X: 10, Y: 1, Text: "free", Pos: Position{Line: 2, Column: 11}},
+	}
+	want := []Position{{Line: 2, Column: 2}, {Line: 2, Column: 4}}
+	if got := diagnosed(checkLabels(figures), OverlappingLabel); !slices.Equal(got, want) {
+		t.Errorf("got overlapping labels at %v, want %v", got, want)
+	}
+}
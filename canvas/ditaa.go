@@ -0,0 +1,274 @@
+package canvas
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Compat defines the ASCII art conventions of another tool, which are understood by the parser.
+type Compat string
+
+const (
+	// NoCompat understands the conventions of this project only.
+	NoCompat Compat = ""
+	// Ditaa understands the conventions of ditaa: the color codes, the shape tags, the dashed lines
+	// drawn with ":" and "=", the rounded corners drawn with "/" and "\", and the point markers.
+	Ditaa Compat = "ditaa"
+)
+
+// ParseCompat returns the compatibility mode with the given name. The empty name denotes no compatibility mode.
+func ParseCompat(name string) (Compat, error) {
+	switch c := Compat(strings.ToLower(name)); c {
+	case NoCompat, Ditaa:
+		return c, nil
+	}
+	return "", fmt.Errorf("unsupported compatibility mode: %q", name)
+}
+
+// ditaaShapes maps the ditaa shape tags to the shapes.
+var ditaaShapes = map[string]ShapeType{
+	"d":  Document,
+	"s":  Database,
+	"io": InputOutput,
+	"c":  Diamond,
+	"o":  Ellipse,
+}
+
+// ditaaShapeTags holds the shape tags understood in the ditaa compatibility mode.
+var ditaaShapeTags = func() map[string]ShapeType {
+	tags := maps.Clone(shapeTags)
+	maps.Copy(tags, ditaaShapes)
+	return tags
+}()
+
+// ditaaColor matches the color code placed inside a box, alone or in front of its label:
+// three hexadecimal digits or one of the color names, like cF00 or cRED.
+var ditaaColor = regexp.MustCompile(`^c([0-9A-F]{3}|RED|GRE|BLU|PNK|YEL|BLK)(?: |$)`)
+
+// ditaaColors holds the colors having a name.
+var ditaaColors = map[string]string{
+	"RED": "#E32",
+	"GRE": "#9D9",
+	"BLU": "#55B",
+	"PNK": "#FAA",
+	"YEL": "#FF3",
+	"BLK": "#000",
+}
+
+// ditaaCorners converts the "/" and "\" characters joining a horizontal and a vertical line
+// into "+" junctions, and returns their positions.
+func ditaaCorners(data [][]rune) map[image.Point]bool {
+	at := func(x, y int) rune {
+		if 0 <= y && y < len(data) && 0 <= x && x < len(data[y]) {
+			return data[y][x]
+		}
+		return 0
+	}
+	horizontal := func(c rune) bool { return c == '-' || c == '=' || c == '+' }
+	vertical := func(c rune) bool { return c == '|' || c == ':' || c == '+' }
+
+	corners := make(map[image.Point]bool)
+	for y, row := range data {
+		for x, c := range row {
+			if c != '/' && c != '\\' {
+				continue
+			}
+			left, right := horizontal(at(x-1, y)), horizontal(at(x+1, y))
+			up, down := vertical(at(x, y-1)), vertical(at(x, y+1))
+
+			// A slash is a top left or a bottom right corner, a backslash a top right or a bottom left one.
+			if c == '/' && (right && down || left && up) || c == '\\' && (left && down || right && up) {
+				data[y][x] = '+'
+				corners[image.Pt(x, y)] = true
+			}
+		}
+	}
+	return corners
+}
+
+// ditaaLiterals marks the ":" and "=" characters as text, unless they continue a line
+// along their axis, in which case they are drawn as dashed lines.
+func ditaaLiterals(data [][]rune, kinds [][]cellKind) {
+	at := func(x, y int) rune {
+		if 0 <= y && y < len(data) && 0 <= x && x < len(data[y]) {
+			return data[y][x]
+		}
+		return 0
+	}
+	for y, row := range data {
+		for x, c := range row {
+			if kinds[y][x] != plainCell {
+				continue
+			}
+			switch c {
+			case '=':
+				if !strings.ContainsRune("-=+<>*", at(x-1, y)) && !strings.ContainsRune("-=+<>*", at(x+1, y)) {
+					kinds[y][x] = literalCell
+				}
+			case ':':
+				if !strings.ContainsRune("|:+^v*", at(x, y-1)) && !strings.ContainsRune("|:+^v*", at(x, y+1)) {
+					kinds[y][x] = literalCell
+				}
+			}
+		}
+	}
+}
+
+// extractDitaaColors removes the color codes from the labels, and returns the fill colors
+// of the boxes enclosing them. It runs before the shapes are extracted, so a shape tag
+// can follow the color code, like in "cF00 {s}".
+func extractDitaaColors(figures []Figure) ([]Figure, map[image.Rectangle]string) {
+	index := newBoxIndex(&Scene{Figures: figures})
+	fills := make(map[image.Rectangle]string)
+
+	var res []Figure
+	for _, fig := range figures {
+		text, ok := fig.(*Text)
+		if !ok {
+			res = append(res, fig)
+			continue
+		}
+		m := ditaaColor.FindStringSubmatch(text.Text)
+		if m == nil {
+			res = append(res, fig)
+			continue
+		}
+		r, ok := index.enclosing(text.Bounds())
+		if !ok {
+			res = append(res, fig)
+			continue
+		}
+		fill, ok := ditaaColors[m[1]]
+		if !ok {
+			fill = "#" + m[1]
+		}
+		fills[r] = fill
+
+		if rest := text.Text[len(m[0]):]; rest != "" {
+			text.Text = rest
+			text.X += utf8.RuneCountInString(m[0])
+			res = append(res, text)
+		}
+	}
+	return res, fills
+}
+
+// extractDitaa replaces the boxes having a fill color or four rounded corners with Box figures,
+// and fills the shapes having a fill color. The labels placed on a dark color are written in white.
+func extractDitaa(figures []Figure, fills map[image.Rectangle]string, rounded map[image.Point]bool) []Figure {
+	index := newBoxIndex(&Scene{Figures: figures})
+	removed := make(map[Figure]bool)
+
+	type style struct {
+		fill    string
+		rounded bool
+	}
+	styles := make(map[image.Rectangle]*style)
+	var order []image.Rectangle
+	get := func(r image.Rectangle) *style {
+		s, ok := styles[r]
+		if !ok {
+			s = new(style)
+			styles[r] = s
+			order = append(order, r)
+		}
+		return s
+	}
+
+	for r, fill := range fills {
+		get(r).fill = fill
+	}
+	for p := range rounded {
+		box, ok := index.around(image.Rect(p.X+1, p.Y+1, p.X+2, p.Y+2))
+		if ok && box.Min == p && rounded[image.Pt(box.Max.X-1, box.Min.Y)] &&
+			rounded[image.Pt(box.Min.X, box.Max.Y-1)] && rounded[image.Pt(box.Max.X-1, box.Max.Y-1)] {
+			get(box).rounded = true
+		}
+	}
+	if len(styles) == 0 {
+		return figures
+	}
+
+	// The labels placed on a dark color are written in white.
+	for _, fig := range figures {
+		text, ok := fig.(*Text)
+		if !ok || text.Color != "#000" {
+			continue
+		}
+		if r, ok := index.enclosing(text.Bounds()); ok && styles[r] != nil && isDark(styles[r].fill) {
+			text.Color = "#fff"
+		}
+	}
+
+	// The shapes keep their outline, while the box takes the place of its first edge.
+	// The boxes are processed from the top, as they can share their edges.
+	slices.SortFunc(order, func(a, b image.Rectangle) int {
+		return cmp.Or(cmp.Compare(a.Min.Y, b.Min.Y), cmp.Compare(a.Min.X, b.Min.X))
+	})
+	boxes := make(map[Figure]*Box)
+	for _, r := range order {
+		s := styles[r]
+		var shape *Shape
+		for _, fig := range figures {
+			if fig, ok := fig.(*Shape); ok && fig.Bounds() == r {
+				shape = fig
+			}
+		}
+		if shape != nil {
+			shape.Fill = s.fill
+			continue
+		}
+
+		box := &Box{X0: r.Min.X, Y0: r.Min.Y, X1: r.Max.X - 1, Y1: r.Max.Y - 1, Fill: s.fill, Rounded: s.rounded}
+		var first Figure
+		for _, fig := range figures {
+			line, ok := fig.(*Line)
+			if !ok || removed[line] || !onBoxEdge(line, r) {
+				continue
+			}
+			if first == nil {
+				first = line
+				box.Color, box.Pos = line.Color, line.Pos
+			}
+			box.Dashed = box.Dashed || line.Dashed
+			removed[line] = true
+		}
+		if first != nil {
+			boxes[first] = box
+		}
+	}
+
+	var res []Figure
+	for _, fig := range figures {
+		if box, ok := boxes[fig]; ok {
+			res = append(res, box)
+		}
+		if !removed[fig] {
+			res = append(res, fig)
+		}
+	}
+	return res
+}
+
+// isDark reports whether the color, given as #RGB, is dark enough for writing on it in white.
+func isDark(color string) bool {
+	if len(color) != 4 || color[0] != '#' {
+		return false
+	}
+	var rgb [3]float64
+	for i := range rgb {
+		v, err := strconv.ParseUint(color[i+1:i+2], 16, 8)
+		if err != nil {
+			return false
+		}
+		rgb[i] = float64(v) / 15
+	}
+	return 0.299*rgb[0]+0.587*rgb[1]+0.114*rgb[2] < 0.5
+}
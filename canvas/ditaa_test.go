@@ -0,0 +1,118 @@
+package canvas
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestParseDitaa(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "color code",
+			src: "+------+\n" +
+				"| cF00 |\n" +
+				"+------+",
+			want: []string{"box fill=#F00"},
+		},
+		{
+			name: "named color code in front of the label",
+			src: "+----------+\n" +
+				"| cBLK api |\n" +
+				"+----------+",
+			want: []string{"box fill=#000", `text "api" color=#fff`},
+		},
+		{
+			name: "document tag",
+			src: "+-----+\n" +
+				"| {d} |\n" +
+				"+-----+",
+			want: []string{"shape doc"},
+		},
+		{
+			name: "storage tag",
+			src: "+-----+\n" +
+				"| {s} |\n" +
+				"+-----+",
+			want: []string{"shape db"},
+		},
+		{
+			name: "input output tag with a label",
+			src: "+---------+\n" +
+				"| {io} in |\n" +
+				"+---------+",
+			want: []string{"shape io", `text "in" color=#000`},
+		},
+		{
+			name: "storage tag after a color code",
+			src: "+----------+\n" +
+				"| cF00 {s} |\n" +
+				"+----------+",
+			want: []string{"shape db fill=#F00"},
+		},
+		{
+			name: "rounded corners",
+			src: "/-----\\\n" +
+				"|  a  |\n" +
+				"\\-----/",
+			want: []string{"box rounded", `text "a" color=#000`},
+		},
+		{
+			name: "dashed line",
+			src:  "--==-->",
+			want: []string{"line dashed"},
+		},
+		{
+			name: "dashed vertical line",
+			src:  "|\n:\n|",
+			want: []string{"line dashed"},
+		},
+		{
+			name: "equal sign in a label",
+			src:  "a = b",
+			want: []string{`text "a = b" color=#000`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scene := (&Diagram{Compat: Ditaa}).ParseASCIIArt(tt.src)
+
+			var got []string
+			for _, fig := range scene.Figures {
+				switch fig := fig.(type) {
+				case *Box:
+					s := "box"
+					if fig.Fill != "" {
+						s += " fill=" + fig.Fill
+					}
+					if fig.Rounded {
+						s += " rounded"
+					}
+					got = append(got, s)
+				case *Shape:
+					s := "shape " + string(fig.Type)
+					if fig.Fill != "" {
+						s += " fill=" + fig.Fill
+					}
+					got = append(got, s)
+				case *Line:
+					if fig.Dashed {
+						got = append(got, "line dashed")
+					} else {
+						got = append(got, "line")
+					}
+				case *Text:
+					got = append(got, fmt.Sprintf("text %q color=%s", fig.Text, fig.Color))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
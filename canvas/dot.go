@@ -0,0 +1,60 @@
+package canvas
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dotShapes maps the shapes to the Graphviz node shapes.
+var dotShapes = map[ShapeType]string{
+	Database:    "cylinder",
+	Cloud:       "ellipse",
+	Actor:       "none",
+	Document:    "note",
+	Diamond:     "diamond",
+	InputOutput: "parallelogram",
+	Ellipse:     "ellipse",
+}
+
+// WriteDOT writes the graph of the boxes and of their connections, returned by NewGraph,
+// in the Graphviz DOT language. The edges follow the arrowheads: the connections having
+// arrowheads at both ends and the ones without arrowheads are marked as such.
+func WriteDOT(w io.Writer, scene *Scene) error {
+	g := NewGraph(scene)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "digraph %s {\n", dotQuote(Title(scene)))
+	for i, node := range g.Nodes {
+		shape := "plaintext"
+		switch {
+		case node.Shape != "":
+			shape = dotShapes[node.Shape]
+		case node.Box:
+			shape = "box"
+		}
+		fmt.Fprintf(&sb, "\tn%d [label=%s, shape=%s];\n", i, dotQuote(node.Label), shape)
+	}
+	for _, e := range g.Edges {
+		switch e.Direction {
+		case Forward:
+			fmt.Fprintf(&sb, "\tn%d -> n%d;\n", e.From, e.To)
+		case Both:
+			fmt.Fprintf(&sb, "\tn%d -> n%d [dir=both];\n", e.From, e.To)
+		default:
+			fmt.Fprintf(&sb, "\tn%d -> n%d [dir=none];\n", e.From, e.To)
+		}
+	}
+	sb.WriteString("}\n")
+
+	if _, err := io.WriteString(w, sb.String()); err != nil {
+		return fmt.Errorf("error writing the DOT graph: %w", err)
+	}
+	return nil
+}
+
+// dotQuote returns the string as a quoted DOT identifier.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,59 @@
+package canvas
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Update the golden files of the tests")
+
+func TestWriteDOT(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		golden string
+	}{
+		{name: "sample", golden: "testdata/sample.dot"},
+		{
+			name: "directions and quotes",
+			src: "# A 5\" \\ disk\n" +
+				"\n" +
+				"+------------+      +---+     +---+\n" +
+				"| say \\\"hi\\\" |<---->| b |-----| c |\n" +
+				"+------------+      +---+     +---+\n",
+			golden: "testdata/quotes.dot",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := tt.src
+			if src == "" {
+				data, err := os.ReadFile("../sample.txt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				src = string(data)
+			}
+			scene, _ := (&Diagram{}).Parse(src)
+
+			var buf bytes.Buffer
+			if err := WriteDOT(&buf, scene); err != nil {
+				t.Fatal(err)
+			}
+			if *update {
+				if err := os.WriteFile(tt.golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(tt.golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package canvas
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"slices"
+	"strings"
+)
+
+// DefaultQuality is the default quality of the JPEG images.
+const DefaultQuality = 90
+
+// maxPaletteSize is the number of colors of the palette based formats.
+const maxPaletteSize = 256
+
+// Encode writes the image into w using the raster format and the quality defined by the options.
+func Encode(w io.Writer, img image.Image, opts Options) error {
+	var err error
+	switch opts.Format {
+	case "", PNG:
+		err = png.Encode(w, img)
+	case PNG8:
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(w, quantize(img))
+	case JPEG:
+		quality := opts.Quality
+		if quality <= 0 {
+			quality = DefaultQuality
+		}
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: min(quality, 100)})
+	case GIF:
+		err = gif.Encode(w, quantize(img), nil)
+	case SVG, PDF:
+		return fmt.Errorf("the %s format requires the scene, not its rasterization", strings.ToUpper(string(opts.Format)))
+	default:
+		return fmt.Errorf("unsupported output format: %q", opts.Format)
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding the %s image: %w", opts.Format, err)
+	}
+	return nil
+}
+
+// Decode reads an image written in one of the raster formats, like the previews of the rendered diagrams.
+func Decode(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// addPNGText adds the title and the description of the image to the encoded PNG image, as international
+// text chunks placed right after the image header. The chunks use the keywords defined by the PNG specification.
+func addPNGText(data []byte, title, desc string) []byte {
+	// The signature and the header chunk, holding 13 bytes of data.
+	const headerSize = len(pngSignature) + 12 + 13
+
+	var buf bytes.Buffer
+	buf.Write(data[:headerSize])
+	for _, text := range [][2]string{{"Title", title}, {"Description", desc}} {
+		// The keyword is followed by the uncompressed flag and method, and by the empty language tag and translated keyword.
+		chunk := append([]byte(text[0]), 0, 0, 0, 0, 0)
+		writeChunk(&buf, "iTXt", append(chunk, text[1]...))
+	}
+	buf.Write(data[headerSize:])
+	return buf.Bytes()
+}
+
+// quantize converts the image to a paletted one. The diagrams use only a few colors, besides
+// the antialiasing shades, so the palette is made of the most frequent colors of the image,
+// while the rest of the colors are replaced by their closest palette entry.
+func quantize(img image.Image) *image.Paletted {
+	counts := make(map[color.RGBA]int)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			counts[color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)]++
+		}
+	}
+
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	key := func(c color.RGBA) uint32 {
+		return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+	}
+	slices.SortFunc(colors, func(a, b color.RGBA) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		// Order the colors having the same frequency deterministically.
+		return cmp.Compare(key(a), key(b))
+	})
+
+	palette := make(color.Palette, 0, maxPaletteSize)
+	for _, c := range colors[:min(len(colors), maxPaletteSize)] {
+		palette = append(palette, c)
+	}
+
+	dst := image.NewPaletted(b, palette)
+	draw.Draw(dst, b, img, b.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,97 @@
+package canvas
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	fonts, err := DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		format Format
+		name   string // the name of the decoded format
+	}{
+		{PNG, "png"},
+		{PNG8, "png"},
+		{JPEG, "jpeg"},
+		{GIF, "gif"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			img, err := Render(context.Background(), strings.NewReader(testDiagram), &buf, Options{Format: tt.format, Fonts: fonts, Scale: 1.5})
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, name, err := image.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != tt.name {
+				t.Errorf("got the %s format, want %s", name, tt.name)
+			}
+			if got, want := decoded.Bounds().Size(), img.Bounds().Size(); got != want {
+				t.Errorf("got the size %v, want %v", got, want)
+			}
+
+			switch tt.format {
+			case PNG8, GIF:
+				paletted, ok := decoded.(*image.Paletted)
+				if !ok {
+					t.Fatalf("got a %T image, want a paletted one", decoded)
+				}
+				if n := len(paletted.Palette); n == 0 || n > maxPaletteSize {
+					t.Errorf("got %d palette colors, want at most %d", n, maxPaletteSize)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for _, format := range []Format{SVG, PDF, "bmp"} {
+		if err := Encode(new(bytes.Buffer), img, Options{Format: format}); err == nil {
+			t.Errorf("the %s format was accepted", format)
+		}
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	// A white image having a black square and a gradient of 512 colors on its first rows.
+	img := image.NewRGBA(image.Rect(0, 0, 256, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 256; x++ {
+			switch {
+			case y < 2:
+				img.Set(x, y, color.RGBA{uint8(x), uint8(y), 0x80, 0xff})
+			case x < 32 && y < 32:
+				img.Set(x, y, color.Black)
+			default:
+				img.Set(x, y, color.White)
+			}
+		}
+	}
+
+	paletted := quantize(img)
+	if n := len(paletted.Palette); n != maxPaletteSize {
+		t.Errorf("got %d palette colors, want %d", n, maxPaletteSize)
+	}
+	// The most frequent colors come first and are kept exactly.
+	if got := paletted.Palette[0]; got != (color.RGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("got the first palette color %v, want white", got)
+	}
+	if got := paletted.At(10, 10); got != (color.RGBA{0, 0, 0, 0xff}) {
+		t.Errorf("got the color %v in the square, want black", got)
+	}
+	if paletted.Bounds() != img.Bounds() {
+		t.Errorf("got the bounds %v, want %v", paletted.Bounds(), img.Bounds())
+	}
+}
@@ -0,0 +1,201 @@
+package canvas
+
+import (
+	"image"
+	"strings"
+	"unicode"
+)
+
+// cellKind defines how a character of the source is treated by the parser.
+type cellKind uint8
+
+const (
+	// plainCell is a character which can be part of a line or of a label.
+	plainCell cellKind = iota
+	// literalCell is a character which is always kept in the label, even if it's a line character.
+	literalCell
+	// syntaxCell is a quote or a backslash escaping the literal characters, which is not rendered.
+	syntaxCell
+)
+
+// isEscapable reports whether the character has to be escaped with a backslash to be kept in the label.
+func isEscapable(c rune) bool {
+	return strings.ContainsRune(`|-+~!*<>^"\`, c)
+}
+
+// isLineChar reports whether the character can be part of a line.
+func isLineChar(c rune) bool {
+	return strings.ContainsRune("|-+~!", c)
+}
+
+// isWordChar reports whether the character is a letter or a digit.
+func isWordChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// scanLiterals finds the characters of the row which are meant as text, even if they could be
+// part of a line. These are the hyphens placed between letters or digits, like in "get-user",
+// the characters escaped by a backslash, like in `\-\-verbose`, and the characters wrapped
+// in double quotes, like in `"a|b"`. The quotes and the escaping backslashes are dropped.
+//
+// A quote opens only at the start of a word and closes only at the end of a word, so the
+// quotes used as inch marks, like in `5"`, are kept. The quoted text cannot contain a line
+// character next to a space, which would be a line drawn beside the text.
+func scanLiterals(row []rune) []cellKind {
+	kinds := make([]cellKind, len(row))
+
+	isSpace := func(i int) bool {
+		return i < 0 || i >= len(row) || row[i] == ' '
+	}
+	// closingQuote returns the position of the unescaped quote closing the one at i, or -1.
+	closingQuote := func(i int) int {
+		for j := i + 1; j < len(row); j++ {
+			switch {
+			case row[j] == '\\' && j+1 < len(row) && isEscapable(row[j+1]):
+				j++
+			case row[j] == '"' && isSpace(j+1):
+				return j
+			case row[j] == ' ' && (isLineChar(row[j-1]) || j+1 < len(row) && isLineChar(row[j+1])):
+				return -1
+			}
+		}
+		return -1
+	}
+
+	// The position of the quote closing the quoted text, or -1 outside of quotes.
+	closing := -1
+	for x := 0; x < len(row); x++ {
+		c := row[x]
+		switch {
+		case c == '\\' && x+1 < len(row) && isEscapable(row[x+1]):
+			kinds[x], kinds[x+1] = syntaxCell, literalCell
+			x++
+		case x == closing:
+			kinds[x] = syntaxCell
+			closing = -1
+		case closing >= 0:
+			kinds[x] = literalCell
+		case c == '"' && isSpace(x-1):
+			if closing = closingQuote(x); closing >= 0 {
+				kinds[x] = syntaxCell
+			}
+		case c == '-' && x > 0 && x+1 < len(row) && isWordChar(row[x-1]) && isWordChar(row[x+1]):
+			kinds[x] = literalCell
+		}
+	}
+	return kinds
+}
+
+// isWordRun reports whether the "|" or the run of hyphens at x is part of a word: a "|" placed
+// between letters or digits, like in "a|b", or hyphens starting a word, like in "--verbose".
+// A "v" following the hyphens is taken as an arrowhead, unless the word goes on after it.
+// It returns the end of the run.
+func isWordRun(row []rune, x int) (int, bool) {
+	wordAt := func(i int) bool { return 0 <= i && i < len(row) && isWordChar(row[i]) }
+	switch row[x] {
+	case '|':
+		return x + 1, wordAt(x-1) && wordAt(x+1)
+	case '-':
+		if x > 0 && row[x-1] != ' ' {
+			return x + 1, false
+		}
+		end := x
+		for end < len(row) && row[end] == '-' {
+			end++
+		}
+		return end, wordAt(end) && (row[end] != 'v' || wordAt(end+1))
+	}
+	return x + 1, false
+}
+
+// wordLiterals marks the line characters which are part of a word as text, like in "a|b" or
+// "--verbose", unless a vertical line continues them on the row above or below.
+// It considers the characters which were not marked as text by scanLiterals.
+func wordLiterals(data [][]rune, kinds [][]cellKind) {
+	// crossed reports whether the cell above or below continues a vertical line.
+	crossed := func(x, y int) bool {
+		for _, dy := range []int{-1, 1} {
+			if 0 <= y+dy && y+dy < len(data) && kinds[y+dy][x] == plainCell && strings.ContainsRune("|!+:^v*", data[y+dy][x]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var words []image.Point
+	for y, row := range data {
+		for x := 0; x < len(row); x++ {
+			if kinds[y][x] != plainCell {
+				continue
+			}
+			end, ok := isWordRun(row, x)
+			for i := x; ok && i < end; i++ {
+				ok = kinds[y][i] == plainCell && !crossed(i, y)
+			}
+			for i := x; ok && i < end; i++ {
+				words = append(words, image.Pt(i, y))
+			}
+			x = end - 1
+		}
+	}
+	for _, p := range words {
+		kinds[p.Y][p.X] = literalCell
+	}
+}
+
+// EscapeText escapes the label text, so it's parsed back as the same label: the characters starting
+// a line, the quotes and the backslashes followed by an escapable character are prefixed by a backslash.
+// The "+", "~" and "!" characters never start a line, they only continue one, so they are escaped only
+// if touchesLine reports a line next to them, like the "|" and the hyphens which are part of a word.
+// touchesLine receives the column of the character relative to the label start, the backslash escaping
+// the first character being placed before the start. A nil touchesLine reports no lines.
+// In the sequence mode the "~" starts the replies, so it's always escaped.
+func EscapeText(text string, mode Mode, touchesLine func(col int) bool) string {
+	row := []rune(text)
+	touches := func(col int) bool { return touchesLine != nil && touchesLine(col) }
+
+	// The hyphens and the "|" which are parsed back as text, as part of a word.
+	words := make([]bool, len(row))
+	for x := 0; x < len(row); x++ {
+		if row[x] == '|' || row[x] == '-' {
+			end, ok := isWordRun(row, x)
+			for i := x; i < end; i++ {
+				words[i] = ok
+			}
+			x = end - 1
+		}
+	}
+
+	var sb strings.Builder
+	col := 0
+	for x, c := range row {
+		escape := false
+		switch c {
+		case '|':
+			escape = !words[x] || touches(col)
+		case '"':
+			// Only the quotes at the start of a word can open a quoted text.
+			escape = x == 0 || row[x-1] == ' '
+
+		case '~':
+			escape = mode == SequenceMode || touches(col)
+		case '+', '!':
+			escape = touches(col)
+		case '-':
+			between := x > 0 && x+1 < len(row) && isWordChar(row[x-1]) && isWordChar(row[x+1])
+			escape = !between && (!words[x] || touches(col))
+		case '\\':
+			// A backslash is literal unless it's followed by an escapable character.
+			escape = x+1 < len(row) && isEscapable(row[x+1])
+		}
+		if escape {
+			sb.WriteRune('\\')
+			if x > 0 {
+				col++
+			}
+		}
+		sb.WriteRune(c)
+		col++
+	}
+	return sb.String()
+}
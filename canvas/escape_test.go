@@ -0,0 +1,129 @@
+package canvas
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseQuotes(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		lines int
+		texts []string
+	}{
+		{
+			name:  "quoted line characters",
+			src:   `"a|b" x`,
+			texts: []string{"a|b x"},
+		},
+		{
+			name:  "inch marks between boxes",
+			src:   `| 5" |--->| 7" |`,
+			lines: 5,
+			texts: []string{`5"`, `7"`},
+		},
+		{
+			name:  "quote inside a word",
+			src:   `say"a|b"`,
+			texts: []string{`say"a|b"`},
+		},
+		{
+			name:  "quotes around a line",
+			src:   `"a |--- b"`,
+			lines: 2,
+			texts: []string{`"a`, `b"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scene := (&Diagram{}).ParseASCIIArt(tt.src)
+
+			var lines int
+			var texts []string
+			for _, fig := range scene.Figures {
+				switch fig := fig.(type) {
+				case *Line:
+					lines++
+				case *Text:
+					texts = append(texts, fig.Text)
+				}
+			}
+			if lines != tt.lines || !slices.Equal(texts, tt.texts) {
+				t.Errorf("got %d lines and texts %q, want %d lines and texts %q", lines, texts, tt.lines, tt.texts)
+			}
+		})
+	}
+}
+
+func TestParseWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		lines int
+		texts []string
+	}{
+		{
+			name:  "pipe between letters",
+			src:   "a|b",
+			texts: []string{"a|b"},
+		},
+		{
+			name:  "hyphens starting a word",
+			src:   "run --verbose -v1",
+			texts: []string{"run --verbose -v1"},
+		},
+		{
+			name:  "arrow pointing down",
+			src:   "  |\n--v",
+			lines: 2,
+		},
+		{
+			name:  "pipe continued by a vertical line",
+			src:   " |\na|b\n |",
+			lines: 1,
+			texts: []string{"a", "b"},
+		},
+		{
+			name:  "words separated by a line",
+			src:   "a | b",
+			lines: 1,
+			texts: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scene := (&Diagram{}).ParseASCIIArt(tt.src)
+
+			var lines int
+			var texts []string
+			for _, fig := range scene.Figures {
+				switch fig := fig.(type) {
+				case *Line:
+					lines++
+				case *Text:
+					texts = append(texts, fig.Text)
+				}
+			}
+			if lines != tt.lines || !slices.Equal(texts, tt.texts) {
+				t.Errorf("got %d lines and texts %q, want %d lines and texts %q", lines, texts, tt.lines, tt.texts)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	for _, text := range []string{`a|b`, `a | b`, `--verbose`, `-- x`, `5"`, `"quoted"`, `a+b~c!`, `\-`, `C:\dir`} {
+		escaped := EscapeText(text, FreeFormMode, nil)
+		scene := (&Diagram{}).ParseASCIIArt(escaped)
+		if len(scene.Figures) != 1 {
+			t.Errorf("EscapeText(%q) = %q parsed as %d figures", text, escaped, len(scene.Figures))
+			continue
+		}
+		if got, ok := scene.Figures[0].(*Text); !ok || got.Text != text {
+			t.Errorf("EscapeText(%q) = %q parsed as %v", text, escaped, scene.Figures[0])
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package canvas
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"unicode/utf8"
+)
+
+// Ending defines the decoration drawn at the start or at the end of a line.
+type Ending string
+
+const (
+	// NoEnding leaves the line end undecorated.
+	NoEnding Ending = ""
+	// Circle draws a bulb at the line end. It's denoted by `*` in the ASCII art.
+	Circle Ending = "circle"
+	// Arrow draws an arrowhead at the line end. It's denoted by `<`, `>`, `^` or `v` in the ASCII art.
+	Arrow Ending = "arrow"
+	// Triangle draws a closed arrowhead at the line end. It marks the synchronous messages of the sequence diagrams.
+	Triangle Ending = "triangle"
+)
+
+// FigureKind identifies the type of a figure in the serialized scene.
+type FigureKind string
+
+// The kinds of figures a scene can contain.
+const (
+	LineKind     FigureKind = "line"
+	TextKind     FigureKind = "text"
+	BoxKind      FigureKind = "box"
+	LinkKind     FigureKind = "link"
+	ShapeKind    FigureKind = "shape"
+	LifelineKind FigureKind = "lifeline"
+)
+
+// Position defines a location in the ASCII source. Both the line and the column are 1-based.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Figure is a drawable element of the diagram.
+// The coordinates of the figures are expressed in cells of the ASCII grid.
+type Figure interface {
+	Drawer
+	// Kind returns the figure type used in the serialized scene.
+	Kind() FigureKind
+	// Bounds returns the cells covered by the figure.
+	Bounds() image.Rectangle
+}
+
+// Line defines a straight line from (X0, Y0) to (X1, Y1) with the given endings and color.
+type Line struct {
+	X0     int      `json:"x0"`
+	Y0     int      `json:"y0"`
+	Start  Ending   `json:"start,omitempty"`
+	X1     int      `json:"x1"`
+	Y1     int      `json:"y1"`
+	End    Ending   `json:"end,omitempty"`
+	Color  string   `json:"color,omitempty"`
+	Dashed bool     `json:"dashed,omitempty"`
+	Pos    Position `json:"pos"`
+}
+
+// NewLine draws a new line from (x0, y0) to (x1, y1) with the given color at the start and end symbol.
+func NewLine(x0, y0 int, start Ending, x1, y1 int, end Ending, color string) *Line {
+	return &Line{X0: x0, Y0: y0, Start: start, X1: x1, Y1: y1, End: end, Color: color}
+}
+
+// Kind implements the Figure interface.
+func (line *Line) Kind() FigureKind { return LineKind }
+
+// isStraight reports whether the line is horizontal or vertical, as the lines of the ASCII art.
+func (line *Line) isStraight() bool {
+	return line.X0 == line.X1 || line.Y0 == line.Y1
+}
+
+// Bounds implements the Figure interface.
+func (line *Line) Bounds() image.Rectangle {
+	// The ends are sorted, as the line can go in any direction.
+	return image.Rect(min(line.X0, line.X1), min(line.Y0, line.Y1), max(line.X0, line.X1)+1, max(line.Y0, line.Y1)+1)
+}
+
+func (line *Line) String() string {
+	return fmt.Sprintf("%s\tline\t(%d,%d) %s -> (%d,%d) %s", line.Pos, line.X0, line.Y0, line.Start, line.X1, line.Y1, line.End)
+}
+
+// Text defines a text annotation at (X, Y) with the given color and font style.
+// A text having a link is rendered as a hyperlink by the vector formats. The link is
+// either written inline, or it's defined by a LinkDef having the Ref reference name.
+type Text struct {
+	X     int       `json:"x"`
+	Y     int       `json:"y"`
+	Text  string    `json:"text"`
+	Color string    `json:"color,omitempty"`
+	Style FontStyle `json:"style"`
+	Link  string    `json:"link,omitempty"`
+	Ref   string    `json:"ref,omitempty"`
+	Pos   Position  `json:"pos"`
+}
+
+// NewText returns a new text annotation at (x0, y0) with the given color.
+func NewText(x0, y0 int, text, color string) *Text {
+	return &Text{X: x0, Y: y0, Text: text, Color: color}
+}
+
+// Kind implements the Figure interface.
+func (text *Text) Kind() FigureKind { return TextKind }
+
+// Bounds implements the Figure interface.
+func (text *Text) Bounds() image.Rectangle {
+	return image.Rect(text.X, text.Y, text.X+utf8.RuneCountInString(text.Text), text.Y+1)
+}
+
+func (text *Text) String() string {
+	return fmt.Sprintf("%s\ttext\t(%d,%d) %q %s", text.Pos, text.X, text.Y, text.Text, text.Style)
+}
+
+// Box defines a rectangle with the top left corner at (X0, Y0) and the bottom right corner at (X1, Y1).
+// The box is filled with the Fill color, if it's set. A box having a link is rendered as a hyperlink
+// by the vector formats.
+type Box struct {
+	X0      int      `json:"x0"`
+	Y0      int      `json:"y0"`
+	X1      int      `json:"x1"`
+	Y1      int      `json:"y1"`
+	Color   string   `json:"color,omitempty"`
+	Fill    string   `json:"fill,omitempty"`
+	Rounded bool     `json:"rounded,omitempty"`
+	Dashed  bool     `json:"dashed,omitempty"`
+	Link    string   `json:"link,omitempty"`
+	Pos     Position `json:"pos"`
+}
+
+// NewBox returns a new box between the (x0, y0) and (x1, y1) corners with the given color.
+func NewBox(x0, y0, x1, y1 int, color string) *Box {
+	return &Box{X0: min(x0, x1), Y0: min(y0, y1), X1: max(x0, x1), Y1: max(y0, y1), Color: color}
+}
+
+// Kind implements the Figure interface.
+func (box *Box) Kind() FigureKind { return BoxKind }
+
+// Bounds implements the Figure interface.
+func (box *Box) Bounds() image.Rectangle {
+	return image.Rect(box.X0, box.Y0, box.X1+1, box.Y1+1)
+}
+
+func (box *Box) String() string {
+	return fmt.Sprintf("%s\tbox\t(%d,%d) (%d,%d)", box.Pos, box.X0, box.Y0, box.X1, box.Y1)
+}
+
+// LinkDef defines the URL of the labels referring to it by name, like a Markdown link reference
+// definition. It's written on its own row, usually at the bottom of the diagram, and it's not drawn.
+type LinkDef struct {
+	X   int      `json:"x"`
+	Y   int      `json:"y"`
+	Ref string   `json:"ref"`
+	URL string   `json:"url"`
+	Pos Position `json:"pos"`
+}
+
+// Kind implements the Figure interface.
+func (def *LinkDef) Kind() FigureKind { return LinkKind }
+
+// Bounds implements the Figure interface. The definition takes no space in the rendered diagram.
+func (def *LinkDef) Bounds() image.Rectangle { return image.Rectangle{} }
+
+// Draw implements the Drawer interface. The definition is not drawn.
+func (def *LinkDef) Draw(ctx *Canvas) {}
+
+func (def *LinkDef) String() string {
+	return fmt.Sprintf("%s\tlink\t[%s]: %s", def.Pos, def.Ref, def.URL)
+}
+
+// figureTypes maps the figure kinds to the constructors used on deserialization.
+var figureTypes = map[FigureKind]func() Figure{
+	LineKind:     func() Figure { return new(Line) },
+	TextKind:     func() Figure { return new(Text) },
+	BoxKind:      func() Figure { return new(Box) },
+	LinkKind:     func() Figure { return new(LinkDef) },
+	ShapeKind:    func() Figure { return new(Shape) },
+	LifelineKind: func() Figure { return new(Lifeline) },
+}
+
+// Scene is the list of figures a diagram consists of.
+type Scene struct {
+	Figures []Figure
+}
+
+// Bounds returns the cells covered by all the figures of the scene.
+func (s *Scene) Bounds() image.Rectangle {
+	var r image.Rectangle
+	for _, fig := range s.Figures {
+		r = r.Union(fig.Bounds())
+	}
+	return r
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// Every figure is serialized as a JSON object having an additional "kind" field.
+func (s *Scene) MarshalJSON() ([]byte, error) {
+	figures := make([]json.RawMessage, 0, len(s.Figures))
+	for _, fig := range s.Figures {
+		data, err := json.Marshal(fig)
+		if err != nil {
+			return nil, err
+		}
+		kind, err := json.Marshal(fig.Kind())
+		if err != nil {
+			return nil, err
+		}
+
+		buf := bytes.NewBufferString(`{"kind":`)
+		buf.Write(kind)
+		if fields := bytes.TrimPrefix(data, []byte("{")); len(fields) > 1 {
+			buf.WriteByte(',')
+			buf.Write(fields)
+		} else {
+			buf.WriteByte('}')
+		}
+		figures = append(figures, buf.Bytes())
+	}
+
+	return json.Marshal(struct {
+		Figures []json.RawMessage `json:"figures"`
+	}{figures})
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (s *Scene) UnmarshalJSON(data []byte) error {
+	var scene struct {
+		Figures []json.RawMessage `json:"figures"`
+	}
+	if err := json.Unmarshal(data, &scene); err != nil {
+		return err
+	}
+
+	s.Figures = make([]Figure, 0, len(scene.Figures))
+	for i, raw := range scene.Figures {
+		var header struct {
+			Kind FigureKind `json:"kind"`
+		}
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return err
+		}
+
+		newFigure, ok := figureTypes[header.Kind]
+		if !ok {
+			return fmt.Errorf("figure %d: unknown kind %q", i, header.Kind)
+		}
+		fig := newFigure()
+		if err := json.Unmarshal(raw, fig); err != nil {
+			return fmt.Errorf("figure %d: %w", i, err)
+		}
+		if line, ok := fig.(*Line); ok && !line.isStraight() {
+			return fmt.Errorf("figure %d: line from (%d, %d) to (%d, %d) is neither horizontal nor vertical",
+				i, line.X0, line.Y0, line.X1, line.Y1)
+		}
+		s.Figures = append(s.Figures, fig)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package canvas
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSceneJSON(t *testing.T) {
+	sample, err := os.ReadFile("../sample.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := (&Diagram{}).Parse(string(sample))
+
+	tests := []struct {
+		name  string
+		scene *Scene
+	}{
+		{"sample", parsed},
+		{"line", &Scene{Figures: []Figure{&Line{X0: 4, Y0: 1, X1: 0, Y1: 1, Start: Arrow, Color: "#f00", Dashed: true, Pos: Position{2, 5}}}}},
+		{"text", &Scene{Figures: []Figure{&Text{X: 1, Y: 2, Text: "api", Style: MonoFont, Link: "https://a.io", Pos: Position{3, 2}}}}},
+		{"box", &Scene{Figures: []Figure{&Box{X1: 6, Y1: 2, Fill: "#0f0", Rounded: true, Dashed: true, Link: "https://a.io"}}}},
+		{"link", &Scene{Figures: []Figure{&LinkDef{Y: 4, Ref: "db", URL: "mailto:ops@example.com", Pos: Position{5, 1}}}}},
+		{"shape", &Scene{Figures: []Figure{&Shape{Type: Database, X1: 6, Y1: 2, Color: "#000", Fill: "#fff"}}}},
+		{"lifeline", &Scene{Figures: []Figure{&Lifeline{X: 2, Y0: 1, Y1: 9, Activations: []Activation{{3, 5}}}}}},
+		{"empty", &Scene{Figures: []Figure{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.scene)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Scene
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(&got, tt.scene) {
+				t.Errorf("got %v after the round trip, want %v", got.Figures, tt.scene.Figures)
+			}
+		})
+	}
+}
+
+func TestUnmarshalSceneErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"unknown kind", `{"figures": [{"kind": "circle"}]}`, `figure 0: unknown kind "circle"`},
+		{"missing kind", `{"figures": [{"x": 1}]}`, `figure 0: unknown kind ""`},
+		{"diagonal line", `{"figures": [{"kind": "text"}, {"kind": "line", "x0": 0, "y0": 0, "x1": 3, "y1": 1}]}`, "figure 1: line from (0, 0) to (3, 1)"},
+		{"unknown shape type", `{"figures": [{"kind": "shape", "type": "hexagon"}]}`, `figure 0: unknown shape type "hexagon"`},
+		{"invalid field", `{"figures": [{"kind": "box", "x0": "a"}]}`, "figure 0:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scene Scene
+			err := json.Unmarshal([]byte(tt.data), &scene)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLineBounds(t *testing.T) {
+	tests := []struct {
+		line *Line
+		want image.Rectangle
+	}{
+		{&Line{X0: 1, Y0: 2, X1: 5, Y1: 2}, image.Rect(1, 2, 6, 3)},
+		{&Line{X0: 5, Y0: 2, X1: 1, Y1: 2}, image.Rect(1, 2, 6, 3)},
+		{&Line{X0: 3, Y0: 4, X1: 3, Y1: 0}, image.Rect(3, 0, 4, 5)},
+	}
+	for _, tt := range tests {
+		if got := tt.line.Bounds(); got != tt.want {
+			t.Errorf("got bounds %v for %v, want %v", got, tt.line, tt.want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package canvas
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	deffont "github.com/esimov/diagram/font"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// FontStyle defines the font used by a text annotation.
+type FontStyle int
+
+const (
+	// BodyFont is the default font used for labels.
+	BodyFont FontStyle = iota
+	// HeadingFont is used for labels marked up as `# Title`.
+	HeadingFont
+	// MonoFont is used for code-like labels wrapped in backticks.
+	MonoFont
+)
+
+// fontStyles maps the font styles to their names used in the serialized scene.
+var fontStyles = map[FontStyle]string{
+	BodyFont:    "body",
+	HeadingFont: "heading",
+	MonoFont:    "mono",
+}
+
+func (style FontStyle) String() string {
+	return fontStyles[style]
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (style FontStyle) MarshalText() ([]byte, error) {
+	name, ok := fontStyles[style]
+	if !ok {
+		return nil, fmt.Errorf("unknown font style: %d", style)
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (style *FontStyle) UnmarshalText(data []byte) error {
+	for s, name := range fontStyles {
+		if name == string(data) {
+			*style = s
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown font style: %q", data)
+}
+
+// fontSizes defines the font size in points for each font style.
+var fontSizes = map[FontStyle]float64{
+	BodyFont:    20,
+	HeadingFont: 24,
+	MonoFont:    18,
+}
+
+// FontSet holds the fonts used for rendering the text annotations.
+// When a glyph is missing from a style's font, the fallback fonts are tried in order.
+// A font set is safe for concurrent rendering, as long as it's not modified meanwhile.
+type FontSet struct {
+	Body      *truetype.Font
+	Heading   *truetype.Font
+	Mono      *truetype.Font
+	Fallbacks []*truetype.Font
+}
+
+// ErrUnsupportedFont is reported for the font files which cannot be used. Only the fonts
+// having TrueType outlines are supported, so the OpenType fonts with CFF outlines,
+// which most .otf files are, cannot be used.
+var ErrUnsupportedFont = errors.New("unsupported font")
+
+// LoadFont parses the TTF/OTF font file found under the given path.
+func LoadFont(path string) (*truetype.Font, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the font file: %w", err)
+	}
+
+	f, err := ParseFont(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the font %q: %w", path, err)
+	}
+	return f, nil
+}
+
+// ParseFont parses the TTF/OTF font data. The font must have TrueType outlines.
+func ParseFont(data []byte) (*truetype.Font, error) {
+	if bytes.HasPrefix(data, []byte("OTTO")) {
+		return nil, fmt.Errorf("%w: OpenType fonts with CFF outlines are not supported", ErrUnsupportedFont)
+	}
+	f, err := truetype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFont, err)
+	}
+	return f, nil
+}
+
+// NewFontSet returns a new font set, which uses the font from the provided path for every style.
+// If the path is empty, the font embedded into the binary is used.
+func NewFontSet(path string) (*FontSet, error) {
+	if path == "" {
+		return DefaultFontSet()
+	}
+
+	f, err := LoadFont(path)
+	if err != nil {
+		return nil, err
+	}
+	return newFontSet(f), nil
+}
+
+// DefaultFontSet returns a font set which uses the embedded default font for every style.
+func DefaultFontSet() (*FontSet, error) {
+	f, err := ParseFont(deffont.Default)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the default font: %w", err)
+	}
+	return newFontSet(f), nil
+}
+
+func newFontSet(f *truetype.Font) *FontSet {
+	return &FontSet{Body: f, Heading: f, Mono: f}
+}
+
+// LoadDir scans the directory for TTF/OTF files and adds them to the font set.
+// The fonts are assigned by their metadata, taking the files in the order of their name:
+// the first monospaced font which is not bold is used for code labels, the first
+// proportional font whose subfamily is bold, black or heavy is used for headings,
+// while all the others are used as fallbacks for missing glyphs.
+// Files which cannot be parsed, like the OpenType fonts with CFF outlines, are skipped:
+// the other fonts are still added, and the skipped ones are reported by an error
+// matching ErrUnsupportedFont.
+func (fs *FontSet) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("cannot read the font directory: %w", err)
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".ttf", ".otf":
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+
+	var skipped []error
+	var mono, heading bool
+	for _, file := range files {
+		f, err := LoadFont(filepath.Join(dir, file))
+		if err != nil {
+			skipped = append(skipped, err)
+			continue
+		}
+
+		switch bold := isBold(f); {
+		case !mono && !bold && isMonospaced(f):
+			fs.Mono, mono = f, true
+		case !heading && bold && !isMonospaced(f):
+			fs.Heading, heading = f, true
+		default:
+			fs.Fallbacks = append(fs.Fallbacks, f)
+		}
+	}
+	return errors.Join(skipped...)
+}
+
+// isBold reports whether the font's subfamily, as found in its name table, is a bold one.
+func isBold(f *truetype.Font) bool {
+	subfamily := strings.ToLower(f.Name(truetype.NameIDFontSubfamily))
+	return containsAny(subfamily, "bold", "black", "heavy")
+}
+
+// isMonospaced reports whether the narrow and the wide glyphs of the font have the same advance width.
+func isMonospaced(f *truetype.Font) bool {
+	scale := fixed.Int26_6(f.FUnitsPerEm())
+	var width fixed.Int26_6
+	for _, r := range "iW0m" {
+		i := f.Index(r)
+		if i == 0 {
+			return false
+		}
+		switch advance := f.HMetric(scale, i).AdvanceWidth; {
+		case width == 0:
+			width = advance
+		case advance != width:
+			return false
+		}
+	}
+	return true
+}
+
+// font returns the font associated with the given style.
+func (fs *FontSet) font(style FontStyle) *truetype.Font {
+	switch style {
+	case HeadingFont:
+		if fs.Heading != nil {
+			return fs.Heading
+		}
+	case MonoFont:
+		if fs.Mono != nil {
+			return fs.Mono
+		}
+	}
+	return fs.Body
+}
+
+// lookup returns the first font from the style's font and the fallbacks which has a glyph for r.
+// If none of them contains the glyph, the style's font is returned.
+func (fs *FontSet) lookup(style FontStyle, r rune) *truetype.Font {
+	primary := fs.font(style)
+	if primary.Index(r) != 0 {
+		return primary
+	}
+	for _, f := range fs.Fallbacks {
+		if f.Index(r) != 0 {
+			return f
+		}
+	}
+	if fs.Body != primary && fs.Body.Index(r) != 0 {
+		return fs.Body
+	}
+	return primary
+}
+
+// fontRun is a chunk of text which can be rendered with the same font.
+type fontRun struct {
+	font *truetype.Font
+	text string
+}
+
+// runs splits the text into chunks based on the font containing the glyphs.
+func (fs *FontSet) runs(style FontStyle, text string) []fontRun {
+	var runs []fontRun
+	for _, r := range text {
+		f := fs.lookup(style, r)
+		if n := len(runs); n > 0 && runs[n-1].font == f {
+			runs[n-1].text += string(r)
+			continue
+		}
+		runs = append(runs, fontRun{f, string(r)})
+	}
+	return runs
+}
+
+// faceKey identifies a font face by its font and size.
+type faceKey struct {
+	font *truetype.Font
+	size float64
+}
+
+// face returns the font face for the given font and style, caching it on the canvas.
+func (ctx *Canvas) face(f *truetype.Font, style FontStyle) font.Face {
+	key := faceKey{f, fontSizes[style]}
+	if face, ok := ctx.faces[key]; ok {
+		return face
+	}
+	face := truetype.NewFace(f, &truetype.Options{Size: key.size})
+	ctx.faces[key] = face
+	return face
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package canvas
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestLoadDir(t *testing.T) {
+	// The file names are misleading on purpose: the fonts are picked by their metadata.
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"a-bold.ttf":    gomono.TTF,
+		"b-code.ttf":    gomonobold.TTF,
+		"c-mono.ttf":    gobold.TTF,
+		"d-regular.ttf": goregular.TTF,
+		"e-broken.ttf":  []byte("not a font"),
+		"f-cff.otf":     []byte("OTTO\x00\x0a"),
+		"notes.txt":     []byte("not a font either"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fonts, err := DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := fonts.Body
+	err = fonts.LoadDir(dir)
+	if !errors.Is(err, ErrUnsupportedFont) {
+		t.Fatalf("got error %v, want %v", err, ErrUnsupportedFont)
+	}
+	for _, name := range []string{"e-broken.ttf", "f-cff.otf"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("got error %v, want %s reported", err, name)
+		}
+	}
+
+	if fonts.Body != body {
+		t.Error("the body font was replaced")
+	}
+	if got := fonts.Mono.Name(truetype.NameIDFontFamily); got != "Go Mono" || isBold(fonts.Mono) {
+		t.Errorf("got the mono font %s %s, want Go Mono Regular", got, fonts.Mono.Name(truetype.NameIDFontSubfamily))
+	}
+	if got := fonts.Heading.Name(truetype.NameIDFontFamily); got != "Go" || !isBold(fonts.Heading) {
+		t.Errorf("got the heading font %s %s, want Go Bold", got, fonts.Heading.Name(truetype.NameIDFontSubfamily))
+	}
+	// The bold monospaced font and the regular one are only used for the missing glyphs.
+	if len(fonts.Fallbacks) != 2 || fonts.Fallbacks[0].Name(truetype.NameIDFontFamily) != "Go Mono" || fonts.Fallbacks[1].Name(truetype.NameIDFontFamily) != "Go" {
+		t.Errorf("got %d fallback fonts, want Go Mono Bold and Go Regular", len(fonts.Fallbacks))
+	}
+}
+
+func TestLoadDirErrors(t *testing.T) {
+	fonts, err := DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fonts.LoadDir(filepath.Join(t.TempDir(), "missing")); err == nil || errors.Is(err, ErrUnsupportedFont) {
+		t.Errorf("got error %v, want the directory reported as unreadable", err)
+	}
+}
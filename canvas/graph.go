@@ -0,0 +1,281 @@
+package canvas
+
+import (
+	"image"
+	"strings"
+)
+
+// Direction defines which way the connection between two nodes points.
+type Direction int
+
+const (
+	// Undirected connections have no arrowheads.
+	Undirected Direction = iota
+	// Forward connections point from the From node to the To node.
+	Forward
+	// Both ways connections have arrowheads at both nodes.
+	Both
+)
+
+// Node is a box of the diagram, or a label connected to other figures.
+type Node struct {
+	// Label holds the labels placed inside the box, joined by spaces.
+	Label string
+	// Bounds holds the cells covered by the box or by the label.
+	Bounds image.Rectangle
+	// Box reports whether the node is a box or a shape.
+	Box bool
+	// Shape holds the type of the shape, if the node is a shape.
+	Shape ShapeType
+}
+
+// Edge is a connection between two nodes, identified by their index.
+type Edge struct {
+	From, To  int
+	Direction Direction
+}
+
+// Graph holds the nodes of the diagram and the connections between them.
+type Graph struct {
+	Nodes []Node
+	Edges []Edge
+	// Labels holds the labels which are neither inside a box nor connected to any figure.
+	Labels []*Text
+}
+
+// terminal is a connection end touching a node.
+type terminal struct {
+	node  int
+	arrow bool
+}
+
+// NewGraph finds the boxes of the scene and the connections between them. The boxes are
+// the Box and Shape figures, and the rectangles made of four lines around a label.
+// The connections are followed across the junctions of the lines, and their direction
+// is given by the arrowheads touching the boxes. The labels connected by lines are nodes as well.
+// The boxes and the labels are indexed by rows, so the large diagrams are handled in about linear time.
+func NewGraph(scene *Scene) *Graph {
+	g := &Graph{}
+	index := newBoxIndex(scene)
+
+	// Find the boxes, grouping the labels placed inside the same box.
+	boxes := make(map[image.Rectangle]int)
+	addBox := func(r image.Rectangle) int {
+		i, ok := boxes[r]
+		if !ok {
+			i = len(g.Nodes)
+			boxes[r] = i
+			g.Nodes = append(g.Nodes, Node{Bounds: r, Box: true})
+		}
+		return i
+	}
+	var texts []*Text
+	for _, fig := range scene.Figures {
+		switch fig := fig.(type) {
+		case *Box:
+			addBox(fig.Bounds())
+		case *Shape:
+			g.Nodes[addBox(fig.Bounds())].Shape = fig.Type
+		case *Text:
+			r, ok := index.enclosing(fig.Bounds())
+			if !ok {
+				texts = append(texts, fig)
+				continue
+			}
+			node := &g.Nodes[addBox(r)]
+			node.Label = strings.TrimSpace(node.Label + " " + fig.Text)
+		}
+	}
+	numBoxes := len(g.Nodes)
+
+	// The lines lying on the box edges are not connections. The edges of the boxes
+	// stacked on each other can be drawn by a single line.
+	border := make(map[image.Point]bool)
+	for _, node := range g.Nodes[:numBoxes] {
+		r := node.Bounds
+		for x := r.Min.X; x < r.Max.X; x++ {
+			border[image.Pt(x, r.Min.Y)] = true
+			border[image.Pt(x, r.Max.Y-1)] = true
+		}
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			border[image.Pt(r.Min.X, y)] = true
+			border[image.Pt(r.Max.X-1, y)] = true
+		}
+	}
+	onEdge := func(line *Line) bool {
+		dx, dy := sign(line.X1-line.X0), sign(line.Y1-line.Y0)
+		for x, y := line.X0, line.Y0; ; x, y = x+dx, y+dy {
+			if !border[image.Pt(x, y)] {
+				return false
+			}
+			if x == line.X1 && y == line.Y1 {
+				return true
+			}
+		}
+	}
+	// The lines which are neither horizontal nor vertical cannot be followed cell by cell, so they are skipped.
+	var lines []*Line
+	for _, fig := range scene.Figures {
+		if line, ok := fig.(*Line); ok && line.isStraight() && !onEdge(line) {
+			lines = append(lines, line)
+		}
+	}
+
+	// Group the lines sharing a cell, like the lines joined by a "+" junction.
+	parent := make([]int, len(lines))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	cells := make(map[image.Point]int)
+	for i, line := range lines {
+		dx, dy := sign(line.X1-line.X0), sign(line.Y1-line.Y0)
+		for x, y := line.X0, line.Y0; ; x, y = x+dx, y+dy {
+			p := image.Pt(x, y)
+			if j, ok := cells[p]; ok {
+				parent[find(i)] = find(j)
+			} else {
+				cells[p] = i
+			}
+			if x == line.X1 && y == line.Y1 {
+				break
+			}
+		}
+	}
+
+	// The boxes and the labels around a cell are looked up by its row.
+	boxRows := make(map[int][]int)
+	for i, node := range g.Nodes[:numBoxes] {
+		r := node.Bounds.Inset(-1)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			boxRows[y] = append(boxRows[y], i)
+		}
+	}
+	// The labels are usually separated by a space from the lines.
+	around := func(text *Text) image.Rectangle {
+		r := text.Bounds()
+		r.Min.X, r.Max.X, r.Min.Y, r.Max.Y = r.Min.X-2, r.Max.X+2, r.Min.Y-1, r.Max.Y+1
+		return r
+	}
+	textRows := make(map[int][]*Text)
+	for _, text := range texts {
+		r := around(text)
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			textRows[y] = append(textRows[y], text)
+		}
+	}
+
+	// The labels are nodes only if a line ends next to them, so they are found after the boxes.
+	labelNodes := make(map[*Text]int)
+	nodeAt := func(p image.Point) (int, bool) {
+		best, area := -1, 0
+		for _, i := range boxRows[p.Y] {
+			r := g.Nodes[i].Bounds.Inset(-1)
+			if p.In(r) && (best < 0 || r.Dx()*r.Dy() < area) {
+				best, area = i, r.Dx()*r.Dy()
+			}
+		}
+		if best >= 0 {
+			return best, true
+		}
+		for _, text := range textRows[p.Y] {
+			if !p.In(around(text)) {
+				continue
+			}
+			i, ok := labelNodes[text]
+			if !ok {
+				i = len(g.Nodes)
+				labelNodes[text] = i
+				g.Nodes = append(g.Nodes, Node{Label: text.Text, Bounds: text.Bounds()})
+			}
+			return i, true
+		}
+		return 0, false
+	}
+
+	// Collect the ends of each group touching a node.
+	var groups []int
+	terminals := make(map[int][]terminal)
+	for i, line := range lines {
+		root := find(i)
+		if _, ok := terminals[root]; !ok {
+			groups = append(groups, root)
+			terminals[root] = nil
+		}
+		ends := []struct {
+			p      image.Point
+			ending Ending
+		}{
+			{image.Pt(line.X0, line.Y0), line.Start},
+			{image.Pt(line.X1, line.Y1), line.End},
+		}
+		for _, end := range ends {
+			if node, ok := nodeAt(end.p); ok {
+				terminals[root] = append(terminals[root], terminal{node, end.ending == Arrow})
+			}
+		}
+	}
+
+	// Connect the ends without arrowheads to the ends having one.
+	seen := make(map[Edge]bool)
+	addEdge := func(e Edge) {
+		if e.From == e.To || seen[e] || seen[Edge{e.To, e.From, e.Direction}] && e.Direction != Forward {
+			return
+		}
+		seen[e] = true
+		g.Edges = append(g.Edges, e)
+	}
+	for _, root := range groups {
+		var tails, heads []int
+		for _, t := range terminals[root] {
+			if t.arrow {
+				heads = append(heads, t.node)
+			} else {
+				tails = append(tails, t.node)
+			}
+		}
+		switch {
+		case len(heads) == 0:
+			for i, a := range tails {
+				for _, b := range tails[i+1:] {
+					addEdge(Edge{a, b, Undirected})
+				}
+			}
+		case len(tails) == 0:
+			for i, a := range heads {
+				for _, b := range heads[i+1:] {
+					addEdge(Edge{a, b, Both})
+				}
+			}
+		default:
+			for _, a := range tails {
+				for _, b := range heads {
+					addEdge(Edge{a, b, Forward})
+				}
+			}
+		}
+	}
+
+	for _, text := range texts {
+		if _, ok := labelNodes[text]; !ok {
+			g.Labels = append(g.Labels, text)
+		}
+	}
+	return g
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
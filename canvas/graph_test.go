@@ -0,0 +1,95 @@
+package canvas
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewGraphDiagonalLine(t *testing.T) {
+	scene := &Scene{Figures: []Figure{
+		&Box{X0: 0, Y0: 0, X1: 4, Y1: 2},
+		&Line{X0: 0, Y0: 0, X1: 3, Y1: 1},
+		&Line{X0: 4, Y0: 1, X1: 8, Y1: 1, End: Arrow},
+	}}
+
+	done := make(chan *Graph)
+	go func() { done <- NewGraph(scene) }()
+	select {
+	case g := <-done:
+		if len(g.Nodes) != 1 {
+			t.Errorf("got %d nodes, want 1", len(g.Nodes))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewGraph does not return for a diagonal line")
+	}
+}
+
+func TestUnmarshalDiagonalLine(t *testing.T) {
+	var scene Scene
+	err := json.Unmarshal([]byte(`{"figures": [{"kind": "line", "x0": 0, "y0": 0, "x1": 3, "y1": 1}]}`), &scene)
+	if err == nil {
+		t.Error("diagonal line was accepted")
+	}
+
+	err = json.Unmarshal([]byte(`{"figures": [{"kind": "line", "x0": 0, "y0": 1, "x1": 3, "y1": 1}]}`), &scene)
+	if err != nil {
+		t.Errorf("horizontal line was rejected: %v", err)
+	}
+}
+
+func TestNewGraphRows(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 50; i++ {
+		var row [3]string
+		for j := 0; j < 10; j++ {
+			row[0] += "+-----+   "
+			row[1] += fmt.Sprintf("| %d%02d |-->", j, i)
+			row[2] += "+-----+   "
+		}
+		for _, line := range row {
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	g := NewGraph((&Diagram{}).ParseASCIIArt(sb.String()))
+
+	labels := make(map[string]int)
+	for i, node := range g.Nodes {
+		if node.Box {
+			labels[node.Label] = i
+		}
+	}
+	if len(labels) != 500 {
+		t.Fatalf("got %d boxes, want 500", len(labels))
+	}
+	edges := make(map[Edge]bool)
+	for _, e := range g.Edges {
+		edges[e] = true
+	}
+	for i := 0; i < 50; i++ {
+		for j := 0; j+1 < 10; j++ {
+			from, to := labels[fmt.Sprintf("%d%02d", j, i)], labels[fmt.Sprintf("%d%02d", j+1, i)]
+			if !edges[Edge{from, to, Forward}] {
+				t.Fatalf("missing arrow from box %d%02d to box %d%02d", j, i, j+1, i)
+			}
+		}
+	}
+}
+
+// BenchmarkNewGraph finds the graph of diagrams of growing size. The boxes are indexed,
+// so the time per cell stays roughly the same.
+func BenchmarkNewGraph(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		src := benchmarkDiagram(n)
+		scene := (&Diagram{}).ParseASCIIArt(src)
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				NewGraph(scene)
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(src)), "ns/cell")
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package canvas
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// The link markup of the labels, borrowed from Markdown.
+var (
+	// [label](url)
+	inlineLink = regexp.MustCompile(`^\[([^\[\]]+)\]\(([^()\s]+)\)$`)
+	// [label][ref] or [label][]
+	refLink = regexp.MustCompile(`^\[([^\[\]]+)\]\[([^\[\]]*)\]$`)
+	// [label], linked only if there is a definition having the label as its name
+	shortcutLink = regexp.MustCompile(`^\[([^\[\]]+)\]$`)
+	// [ref]: url
+	linkDefinition = regexp.MustCompile(`^\[([^\[\]]+)\]: (\S+)$`)
+)
+
+// isSafeLink reports whether the link target uses one of the http, https and mailto schemes.
+// The other targets, like the javascript: URLs, are never turned into hyperlinks.
+func isSafeLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// extractLinks converts the labels defining a link reference into LinkDef figures,
+// and sets the link of the labels using the link markup. The markup is removed from the labels.
+// The links which are not http, https or mailto URLs are kept, but they are reported and not rendered.
+func extractLinks(figures []Figure) []Diagnostic {
+	var diags []Diagnostic
+
+	// The reference names are case insensitive.
+	urls := make(map[string]string)
+	for i, fig := range figures {
+		text, ok := fig.(*Text)
+		if !ok {
+			continue
+		}
+		if m := linkDefinition.FindStringSubmatch(text.Text); m != nil {
+			def := &LinkDef{X: text.X, Y: text.Y, Ref: m[1], URL: m[2], Pos: text.Pos}
+			figures[i] = def
+			if !isSafeLink(def.URL) {
+				diags = append(diags, unsafeLink(def.Pos, def.URL))
+			}
+			if _, ok := urls[strings.ToLower(def.Ref)]; !ok {
+				urls[strings.ToLower(def.Ref)] = def.URL
+			}
+		}
+	}
+
+	for _, fig := range figures {
+		text, ok := fig.(*Text)
+		if !ok {
+			continue
+		}
+		if m := inlineLink.FindStringSubmatch(text.Text); m != nil {
+			text.Text, text.Link = m[1], m[2]
+			text.X++
+			if !isSafeLink(text.Link) {
+				diags = append(diags, unsafeLink(text.Pos, text.Link))
+			}
+			continue
+		}
+		if m := refLink.FindStringSubmatch(text.Text); m != nil {
+			ref := m[2]
+			if ref == "" {
+				ref = m[1]
+			}
+			url, ok := urls[strings.ToLower(ref)]
+			if !ok {
+				diags = append(diags, Diagnostic{
+					Pos:     text.Pos,
+					Code:    UndefinedLink,
+					Message: fmt.Sprintf("link reference %q is not defined", ref),
+				})
+				continue
+			}
+			text.Text, text.Link, text.Ref = m[1], url, ref
+			text.X++
+			continue
+		}
+		if m := shortcutLink.FindStringSubmatch(text.Text); m != nil {
+			if url, ok := urls[strings.ToLower(m[1])]; ok {
+				text.Text, text.Link, text.Ref = m[1], url, m[1]
+				text.X++
+			}
+		}
+	}
+	return diags
+}
+
+// unsafeLink returns the diagnostic of a link target which is not rendered.
+func unsafeLink(pos Position, link string) Diagnostic {
+	return Diagnostic{
+		Pos:     pos,
+		Code:    UnsafeLink,
+		Message: fmt.Sprintf("link %q is not an http, https or mailto URL", link),
+	}
+}
+
+// link is a hyperlink covering a rectangular area of the canvas.
+type link struct {
+	url            string
+	x0, y0, x1, y1 float64
+}
+
+// figureLink returns the hyperlink of the figure. The link of a label placed inside
+// a box, drawn with four lines, covers the whole box.
+func figureLink(boxes *boxIndex, fig Figure) (link, bool) {
+	switch fig := fig.(type) {
+	case *Box:
+		if !isSafeLink(fig.Link) {
+			return link{}, false
+		}
+		return link{fig.Link, X(float64(fig.X0)), Y(float64(fig.Y0)), X(float64(fig.X1)), Y(float64(fig.Y1))}, true
+	case *Text:
+		if !isSafeLink(fig.Link) {
+			return link{}, false
+		}
+		r := fig.Bounds()
+		if box, ok := boxes.enclosing(r); ok {
+			return link{fig.Link, X(float64(box.Min.X)), Y(float64(box.Min.Y)), X(float64(box.Max.X - 1)), Y(float64(box.Max.Y - 1))}, true
+		}
+		// The text starts at the cell center and the larger fonts extend over more cells.
+		width := float64(r.Dx()) * fontSizes[fig.Style] / fontSizes[BodyFont]
+		y := Y(float64(fig.Y))
+		return link{fig.Link, X(float64(fig.X)), y - CellSize/2, X(float64(fig.X) + width), y + CellSize/2}, true
+	}
+	return link{}, false
+}
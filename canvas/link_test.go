@@ -0,0 +1,46 @@
+package canvas
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestUnsafeLinks(t *testing.T) {
+	src := "[safe](https://example.com)\n" +
+		"[mail](mailto:ops@example.com)\n" +
+		"[unsafe](javascript:alert)\n" +
+		"[ref]\n" +
+		"\n" +
+		"[ref]: JavaScript:alert\n"
+
+	scene, diags := (&Diagram{}).Parse(src)
+	var unsafe int
+	for _, diag := range diags {
+		if diag.Code == UnsafeLink {
+			unsafe++
+		}
+	}
+	if unsafe != 2 {
+		t.Errorf("got %d unsafe links, want 2\n%s", unsafe, diags)
+	}
+
+	fonts, err := DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := RenderScene(context.Background(), scene, &buf, Options{Format: SVG, Fonts: fonts}); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	for _, href := range []string{"https://example.com", "mailto:ops@example.com"} {
+		if !strings.Contains(svg, `href="`+href+`"`) {
+			t.Errorf("missing link to %s", href)
+		}
+	}
+	if strings.Contains(strings.ToLower(svg), `href="javascript:`) {
+		t.Error("javascript: link was rendered")
+	}
+}
@@ -3,12 +3,33 @@
 package canvas
 
 import (
-	"reflect"
+	"container/heap"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
 	"strings"
-
-	"github.com/fogleman/gg"
 )
 
+// offsets is a min-heap of the row-major offsets of the grid cells.
+type offsets []int
+
+func (h offsets) Len() int           { return len(h) }
+func (h offsets) Less(i, j int) bool { return h[i] < h[j] }
+func (h offsets) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *offsets) Push(x any) { *h = append(*h, x.(int)) }
+
+func (h *offsets) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
 // Point is an auxiliary struct used during parsing.
 type Point struct {
 	x, y int
@@ -19,95 +40,125 @@ func NewPoint(x, y int) *Point {
 	return &Point{x, y}
 }
 
-// Line struct defines the line x & y coordinates, the starting and ending type and the color.
-type Line struct {
-	x0, y0 int
-	start  string
-	x1, y1 int
-	end    string
-	color  string
+// applyMarkup selects the text font style based on the label markup.
+// A label starting with "# " is rendered as heading, while a label
+// wrapped in backticks is rendered with the monospace font.
+func (text *Text) applyMarkup() {
+	switch {
+	case strings.HasPrefix(text.Text, "# "):
+		text.Text = text.Text[2:]
+		text.X += 2
+		text.Style = HeadingFont
+	case len(text.Text) > 2 && strings.HasPrefix(text.Text, "`") && strings.HasSuffix(text.Text, "`"):
+		text.Text = text.Text[1 : len(text.Text)-1]
+		text.X++
+		text.Style = MonoFont
+	}
 }
 
-// NewLine draws a new line from (x0, y0) to (x1, y1) with the given color at the start and end symbol.
-func NewLine(x0, y0 int, start string, x1, y1 int, end string, color string) *Line {
-	return &Line{x0, y0, start, x1, y1, end, color}
+// Diagram holds the options of the ASCII art parsing.
+type Diagram struct {
+	// Mode defines how the figures are interpreted. The zero value parses free form diagrams.
+	Mode Mode
+	// Compat enables the conventions of another tool on top of the ones of this project.
+	Compat Compat
 }
 
-// Text struct containing the text x and y coordinates and the color.
-type Text struct {
-	x0, y0 int
-	text   string
-	color  string
+// ParseASCIIArt parses a given ASCII string into a scene of figures.
+func (d *Diagram) ParseASCIIArt(str string) *Scene {
+	scene, _ := d.Parse(str)
+	return scene
 }
 
-// NewText returns a new text annotation at (x0, y0) with the given color.
-func NewText(x0, y0 int, text, color string) *Text {
-	return &Text{x0, y0, text, color}
+// Parse parses a given ASCII string into a scene of figures. Besides the scene it also
+// returns the warnings about the constructs which were probably not drawn as intended.
+//
+// The source is scanned only once: the lines are extracted in the order their first
+// character is met, so the parsing time grows linearly with the size of the diagram.
+func (d *Diagram) Parse(str string) (*Scene, []Diagnostic) {
+	return d.parse(str, false)
 }
 
-// Figures defines a compounded struct containing the Line and Text struct elements.
-type Figures struct {
-	Line
-	Text
+// ParseOutline parses a given ASCII string into its lines and labels only, as they are written:
+// the links, the label markup, the shape tags and the ditaa color codes are kept in the labels,
+// and the sequence diagrams are not recognized. The lines still follow the conventions of the
+// diagram mode and of the compatibility mode. It's used for writing the diagram back as ASCII art.
+func (d *Diagram) ParseOutline(str string) *Scene {
+	scene, _ := d.parse(str, true)
+	return scene
 }
 
-// Diagram defines a basic empty struct.
-type Diagram struct{}
-
-// ParseASCIIArt parses a given ASCII string into a list of figures.
-func (d *Diagram) ParseASCIIArt(str string) []*Figures {
-	var figures []*Figures
+// parse parses the ASCII string, recognizing only the lines and the labels if outline is set.
+func (d *Diagram) parse(str string, outline bool) (*Scene, []Diagnostic) {
+	var figures []Figure
+	var segments []Line
 
 	lines := strings.Split(str, "\n")
 	height := len(lines)
 
-	// Get diagram widest line.
-	width := func(lines []string) int {
-		var max int
-		for _, line := range lines {
-			if len(line) > max {
-				max = len(line)
-			}
+	// Convert strings into a mutable matrix of characters, padded to the diagram widest line.
+	data := make([][]rune, height)
+	var width int
+	for y, line := range lines {
+		data[y] = []rune(line)
+		width = max(width, len(data[y]))
+	}
+	for y := range data {
+		for len(data[y]) < width {
+			data[y] = append(data[y], ' ')
 		}
-		return max
-	}(lines)
+	}
 
-	data := make([][]string, height)
+	// The ditaa rounded corners are joining the lines like the "+" corners.
+	var rounded map[image.Point]bool
+	if d.Compat == Ditaa {
+		rounded = ditaaCorners(data)
+	}
 
-	// Convert strings into a mutable matrix of characters.
-	for y := 0; y < height; y++ {
-		line := lines[y]
-		data[y] = make([]string, width)
-		for x := 0; x < len(line); x++ {
-			data[y][x] = string(line[x])
-		}
-		for x := len(line); x < width; x++ {
-			data[y][x] = " "
-		}
+	// Find the characters meant as text, which are not extracted as lines.
+	kinds := make([][]cellKind, height)
+	for y := range data {
+		kinds[y] = scanLiterals(data[y])
+	}
+	wordLiterals(data, kinds)
+	if d.Compat == Ditaa {
+		ditaaLiterals(data, kinds)
+	}
+
+	// Keep a copy of the original matrix for the diagnostics.
+	src := make([][]rune, height)
+	for y := range data {
+		src[y] = slices.Clone(data[y])
 	}
 
-	// Get a character from the slice or zero out if we are out of bounds.
-	at := func(y, x int) string {
-		if 0 <= y && y < height && 0 <= x && x < width {
+	// Get a character from the slice or zero out if we are out of bounds or the character is a text.
+	at := func(y, x int) rune {
+		if 0 <= y && y < height && 0 <= x && x < width && kinds[y][x] == plainCell {
 			return data[y][x]
 		}
-		return ""
+		return 0
 	}
 
 	// Returns true if the character can be part of the line.
 	isPartOfLine := func(x, y int) bool {
-		c := at(y, x)
-		switch {
-		case c == "|" || c == "-" || c == "+" || c == "~" || c == "!":
+		switch at(y, x) {
+		case '|', '-', '+', '~', '!':
 			return true
+		case ':', '=':
+			return d.Compat == Ditaa
 		}
 		return false
 	}
 
-	toColor := func(x, y int) string {
+	// Returns true if the character makes the line dashed.
+	isDashed := func(x, y int) bool {
 		c := at(y, x)
-		switch {
-		case c == "~" || c == "!":
+		return (c == ':' || c == '=') && d.Compat == Ditaa
+	}
+
+	toColor := func(x, y int) string {
+		switch at(y, x) {
+		case '~', '!':
 			return "#666"
 		}
 		return ""
@@ -115,104 +166,128 @@ func (d *Diagram) ParseASCIIArt(str string) []*Figures {
 
 	// Returns true if the character is a line ending decoration.
 	isLineEnding := func(x, y int) bool {
-		c := at(y, x)
-		switch {
-		case c == "*" || c == "<" || c == ">" || c == "^" || c == "v":
+		switch at(y, x) {
+		case '*', '<', '>', '^', 'v':
 			return true
 		}
 		return false
 	}
 
+	// Returns true if the character starts an unextracted line. The replies of
+	// the sequence diagrams can be drawn with "~" only.
+	isLineChar := func(x, y int) bool {
+		c := at(y, x)
+		return c == '|' || c == '-' || c == '~' && d.Mode == SequenceMode || isDashed(x, y)
+	}
+
+	// The source is scanned in row-major order. The corners turned into line characters
+	// by the erasure of a line are queued in a heap, ordered by their row-major offset,
+	// because they can precede the scan position.
+	var next int
+	var queue offsets
+
 	// Finds a character that belongs to an unextracted line.
 	findLineChar := func() *Point {
-		for y := 0; y < height; y++ {
-			for x := 0; x < width; x++ {
-				if data[y][x] == "|" || data[y][x] == "-" {
-					return NewPoint(x, y)
-				}
+		for queue.Len() > 0 {
+			p := heap.Pop(&queue).(int)
+			if isLineChar(p%width, p/width) {
+				return NewPoint(p%width, p/width)
+			}
+		}
+		for ; next < width*height; next++ {
+			if isLineChar(next%width, next/width) {
+				return NewPoint(next%width, next/width)
 			}
 		}
 		return nil
 	}
 
 	// Converts line's character to the direction of line's growth.
-	dir := map[string]*Point{
-		"-": NewPoint(1, 0),
-		"|": NewPoint(0, 1),
+	dir := map[rune]*Point{
+		'-': NewPoint(1, 0),
+		'~': NewPoint(1, 0),
+		'|': NewPoint(0, 1),
+		'=': NewPoint(1, 0),
+		':': NewPoint(0, 1),
 	}
 
-	// Erases character that belongs to the extracted line.
+	// Erases character that belongs to the extracted line. The ditaa point markers
+	// placed between two lines are kept, so they are the endings of both lines.
 	eraseChar := func(x, y, dx, dy int) {
-		c := at(y, x)
-		switch {
-		case c == "|" || c == "-" || c == "*" || c == ">" || c == "<" || c == "^" || c == "v" || c == "~" || c == "!":
-			data[y][x] = " "
-			return
-		case c == "+":
+		switch at(y, x) {
+		case '*':
+			if d.Compat != Ditaa || !isPartOfLine(x-1, y) && !isPartOfLine(x+1, y) && !isPartOfLine(x, y-1) && !isPartOfLine(x, y+1) {
+				data[y][x] = ' '
+			}
+		case '|', '-', '>', '<', '^', 'v', '~', '!', ':', '=':
+			data[y][x] = ' '
+		case '+':
 			dx = 1 - dx
 			dy = 1 - dy
-			data[y][x] = " "
-
-			c1 := at(y-dy, x-dx)
-			switch {
-			case c1 == "|" || c1 == "!" || c1 == "+":
-				data[y][x] = "|"
-				return
-			case c1 == "-" || c1 == "~" || c1 == "+":
-				data[y][x] = "-"
-				return
+			data[y][x] = ' '
+
+			switch c := at(y-dy, x-dx); {
+			case c == '|' || c == '!' || c == '+':
+				data[y][x] = '|'
+			case c == '-' || c == '~':
+				data[y][x] = '-'
+			case isDashed(x-dx, y-dy):
+				data[y][x] = c
+			default:
+				switch c := at(y+dy, x+dx); {
+				case c == '|' || c == '!' || c == '+':
+					data[y][x] = '|'
+				case c == '-' || c == '~':
+					data[y][x] = '-'
+				case isDashed(x+dx, y+dy):
+					data[y][x] = c
+				}
 			}
-
-			c2 := at(y+dy, x+dx)
-			switch {
-			case c2 == "|" || c2 == "!" || c2 == "+":
-				data[y][x] = "|"
-				return
-			case c2 == "-" || c2 == "~" || c2 == "+":
-				data[y][x] = "-"
-				return
+			if data[y][x] != ' ' && y*width+x < next {
+				heap.Push(&queue, y*width+x)
 			}
-			return
 		}
 	}
 
 	// Erase the given extracted line.
 	erase := func(line *Line) {
 		var dx, dy int
-		if line.x0 != line.x1 {
+		if line.X0 != line.X1 {
 			dx = 1
 		} else {
 			dx = 0
 		}
-		if line.y0 != line.y1 {
+		if line.Y0 != line.Y1 {
 			dy = 1
 		} else {
 			dy = 0
 		}
 		if dx != 0 || dy != 0 {
-			x0, y0 := line.x0+dx, line.y0+dy
-			x1, y1 := line.x1-dx, line.y1-dy
+			x0, y0 := line.X0+dx, line.Y0+dy
+			x1, y1 := line.X1-dx, line.Y1-dy
 
 			for x0 <= x1 && y0 <= y1 {
 				eraseChar(x0, y0, dx, dy)
 				x0 += dx
 				y0 += dy
 			}
-			eraseChar(line.x0, line.y0, dx, dy)
-			eraseChar(line.x1, line.y1, dx, dy)
+			eraseChar(line.X0, line.Y0, dx, dy)
+			eraseChar(line.X1, line.Y1, dx, dy)
 		} else {
-			eraseChar(line.x0, line.y0, dx, dy)
+			eraseChar(line.X0, line.Y0, dx, dy)
 		}
 	}
 
 	// Extract a single line and erase it from the ascii art matrix.
 	extractLine := func() bool {
-		var color, start, end string
+		var start, end Ending
 
 		ch := findLineChar()
 		if ch == nil {
 			return false
 		}
+		color := toColor(ch.x, ch.y)
+		dashed := isDashed(ch.x, ch.y)
 
 		d := dir[data[ch.y][ch.x]]
 		// Find line's start by advancing in the opposite direction.
@@ -224,15 +299,16 @@ func (d *Diagram) ParseASCIIArt(str string) []*Figures {
 			if color == "" {
 				color = toColor(x0, y0)
 			}
+			dashed = dashed || isDashed(x0, y0)
 		}
 		if isLineEnding(x0-d.x, y0-d.y) {
 			// Line has a decorated start. Extract is as well.
 			x0 -= d.x
 			y0 -= d.y
-			if data[y0][x0] == "*" {
-				start = "circle"
+			if data[y0][x0] == '*' {
+				start = Circle
 			} else {
-				start = "arrow"
+				start = Arrow
 			}
 		}
 		// Find line's end by advancing forward in the given direction.
@@ -244,71 +320,98 @@ func (d *Diagram) ParseASCIIArt(str string) []*Figures {
 			if color == "" {
 				color = toColor(x1, y1)
 			}
+			dashed = dashed || isDashed(x1, y1)
 		}
 		if isLineEnding(x1+d.x, y1+d.y) {
 			// Line has a decorated end. Extract it.
 			x1 += d.x
 			y1 += d.y
-			if data[y1][x1] == "*" {
-				end = "circle"
+			if data[y1][x1] == '*' {
+				end = Circle
 			} else {
-				end = "arrow"
+				end = Arrow
 			}
 		}
 
 		// Create line object and erase line from the ascii art matrix.
 		line := NewLine(x0, y0, start, x1, y1, end, color)
+		line.Pos = Position{Line: y0 + 1, Column: x0 + 1}
+		line.Dashed = dashed
 
-		figures = append(figures, &Figures{*line, Text{}})
+		figures = append(figures, line)
+		segments = append(segments, *line)
 		erase(line)
 
 		// Adjust line start and end to accommodate for arrow endings.
 		// Those should not intersect with their targets but should touch them instead.
 		// Should be done after erasure to ensure that erase deletes arrowheads.
-		if start == "arrow" {
-			line.x0 -= d.x
-			line.y0 -= d.y
+		if start == Arrow {
+			line.X0 -= d.x
+			line.Y0 -= d.y
 		}
 
-		if end == "arrow" {
-			line.x1 += d.x
-			line.y1 += d.y
+		if end == Arrow {
+			line.X1 += d.x
+			line.Y1 += d.y
 		}
 		return true
 	}
 	// Extract all non space characters that were left after line extraction as text objects.
 	extractText := func() {
+		// The column where a word has to start to be joined with the last label, or -1.
+		// The words separated by an extracted line are not joined.
+		joinAt := -1
+		nextJoin := func(y, end int) int {
+			if end < width && src[y][end] == ' ' {
+				return end + 1
+			}
+			return -1
+		}
 		for y := 0; y < height; y++ {
 			for x := 0; x < width; x++ {
-				if data[y][x] != " " {
+				if data[y][x] != ' ' {
 					start, end := x, x
-					for end < width && data[y][end] != " " {
+					for end < width && data[y][end] != ' ' {
 						end++
 					}
-					getRange := func(start, end int) []string {
-						return data[y][start:end]
-					}
-					text := strings.Join(getRange(start, end), "")
-					if len(figures) > 0 {
-						// Check if it can be concatenated with a previously found text annotation.
-						prev := figures[len(figures)-1]
-						if prev.Text.x0+len(prev.text)+1 == start {
-							// If they touch concatenate them
-							prev.text = prev.text + " " + text
-						} else {
-							color := "#000"
-							if string(text[0]) == "\\" && string(text[len(text)-1]) == "\\" {
-								text = text[0 : len(text)-1]
-								color = "#666"
-							}
-							newtext := NewText(x, y, text, color)
-							figures = append(figures, &Figures{Line{}, *newtext})
+					x = end
+
+					// Drop the quotes and the escaping backslashes.
+					var runes []rune
+					textX := -1
+					for i := start; i < end; i++ {
+						if kinds[y][i] == syntaxCell {
+							continue
+						}
+						if textX < 0 {
+							textX = i
 						}
-						x = end
-					} else {
-						newtext := NewText(x, y, text, "#000")
-						figures = append(figures, &Figures{Line{}, *newtext})
+						runes = append(runes, data[y][i])
 					}
+					if len(runes) == 0 {
+						continue
+					}
+					text := string(runes)
+
+					// Check if it can be concatenated with a previously found text annotation.
+					if prev, ok := lastText(figures); ok && prev.Y == y && joinAt == start {
+						// If they touch concatenate them
+						prev.Text = prev.Text + " " + text
+						joinAt = nextJoin(y, end)
+						continue
+					}
+					color := "#000"
+					joinAt = nextJoin(y, end)
+					if end-start > 1 && data[y][start] == '\\' && data[y][end-1] == '\\' &&
+						kinds[y][start] == plainCell && kinds[y][end-1] == plainCell {
+						text = text[0 : len(text)-1]
+						color = "#666"
+						// The muted labels are not joined with the following words.
+						joinAt = -1
+					}
+					newtext := NewText(textX, y, text, color)
+					newtext.Pos = Position{Line: y + 1, Column: start + 1}
+					figures = append(figures, newtext)
 				}
 			}
 		}
@@ -316,37 +419,103 @@ func (d *Diagram) ParseASCIIArt(str string) []*Figures {
 
 	for extractLine() {
 	}
+	diags := checkLeftovers(data, kinds)
+	diags = append(diags, checkGaps(src, segments)...)
+	diags = append(diags, checkCorners(segments)...)
+
 	extractText()
+	if outline {
+		return &Scene{Figures: figures}, nil
+	}
+	diags = append(diags, extractLinks(figures)...)
+	if d.Compat == Ditaa {
+		var fills map[image.Rectangle]string
+		figures, fills = extractDitaaColors(figures)
+		figures = extractShapes(figures, ditaaShapeTags)
+		figures = extractDitaa(figures, fills, rounded)
+	} else {
+		figures = extractShapes(figures, shapeTags)
+	}
 
-	return figures
+	for _, fig := range figures {
+		if text, ok := fig.(*Text); ok {
+			text.applyMarkup()
+		}
+	}
+	diags = append(diags, checkLabels(figures)...)
+
+	if d.Mode == SequenceMode {
+		figures = extractSequence(figures)
+	}
+
+	slices.SortStableFunc(diags, func(a, b Diagnostic) int {
+		if a.Pos.Line != b.Pos.Line {
+			return a.Pos.Line - b.Pos.Line
+		}
+		return a.Pos.Column - b.Pos.Column
+	})
+
+	return &Scene{Figures: figures}, diags
 }
 
-// DrawDiagram generates the diagram and saves into the image file.
+// lastText returns the last figure if it's a text annotation.
+func lastText(figures []Figure) (*Text, bool) {
+	if len(figures) == 0 {
+		return nil, false
+	}
+	text, ok := figures[len(figures)-1].(*Text)
+	return text, ok
+}
+
+// DrawDiagram generates the diagram and saves into the image file, using the font found
+// under fontPath. If the path is empty, the embedded font is used.
 func DrawDiagram(content string, output string, fontPath string) error {
-	var width, height int
+	fonts, err := NewFontSet(fontPath)
+	if err != nil {
+		return err
+	}
+	return DrawDiagramWithFonts(content, output, fonts)
+}
 
+// DrawDiagramWithFonts generates the diagram and saves into the image file, using the font set.
+func DrawDiagramWithFonts(content string, output string, fonts *FontSet) error {
 	diagram := &Diagram{}
-	figures := diagram.ParseASCIIArt(content)
+	return DrawScene(diagram.ParseASCIIArt(content), output, fonts)
+}
 
-	for _, fig := range figures {
-		if reflect.TypeOf(fig.Line).String() == "canvas.Line" {
-			width = max(width, int(X(float64(fig.Line.x1)+1)))
-			height = max(height, int(Y(float64(fig.Line.y1)+1)))
-		}
-	}
+// DrawScene draws the scene figures and saves the result into the image file.
+// The image format is chosen by the file extension. The file is replaced only
+// when the rendering succeeds, otherwise it's left untouched.
+func DrawScene(scene *Scene, output string, fonts *FontSet) error {
+	return WriteFile(output, func(w io.Writer) error {
+		_, err := RenderScene(context.Background(), scene, w, Options{Fonts: fonts, Format: FormatOf(output)})
+		return err
+	})
+}
 
-	ctx := gg.NewContext(width, height)
-	canvas := NewCanvas(ctx, fontPath, 3)
-	canvas.DrawRectangle(0, 0, float64(width), float64(height))
-	canvas.SetRGBA(1, 1, 1, 1)
-	canvas.Fill()
+// WriteFile calls write with a temporary file created next to the output file, and renames it
+// to the output file once write succeeds. On failure the temporary file is removed, so neither
+// an empty nor a truncated file, looking newer than its source, is left behind.
+func WriteFile(output string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to create the output file: %w", err)
+	}
+	tmp := f.Name()
 
-	for _, fig := range figures {
-		// Do not draw empty lines
-		if fig.Line.x1 != 0 {
-			fig.Line.Draw(canvas)
-		}
-		fig.Text.Draw(canvas)
+	err = write(f)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("unable to write the output file: %w", cerr)
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, output)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
 	}
-	return canvas.SavePNG(output)
+	return nil
 }
@@ -0,0 +1,80 @@
+package canvas
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "diagram.png")
+	if err := os.WriteFile(output, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	errWrite := errors.New("write failed")
+	err := WriteFile(output, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errWrite
+	})
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("got error %v, want %v", err, errWrite)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "old" {
+		t.Errorf("failed write changed the output file to %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("failed write left %d files in the directory, want 1", len(entries))
+	}
+
+	err = WriteFile(output, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "new" {
+		t.Errorf("got output %q, want %q", data, "new")
+	}
+}
+
+// benchmarkDiagram returns a diagram of n rows of boxes, each row having ten boxes
+// connected by arrows, followed by a line going down to the next row.
+func benchmarkDiagram(n int) string {
+	var sb strings.Builder
+	for i := 0; i < n; i++ {
+		row := [4]string{}
+		for j := 0; j < 10; j++ {
+			row[0] += "+-------+   "
+			row[1] += "| box   |-->"
+			row[2] += "+---+---+   "
+			row[3] += "    |       "
+		}
+		for _, line := range row {
+			sb.WriteString(line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// BenchmarkParse parses diagrams of growing size. The time per cell of the ASCII grid
+// stays roughly the same, as the parsing time grows linearly with the size of the diagram.
+func BenchmarkParse(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		src := benchmarkDiagram(n)
+		cells := len(src)
+		b.Run(fmt.Sprintf("rows=%d", n), func(b *testing.B) {
+			d := &Diagram{}
+			for i := 0; i < b.N; i++ {
+				d.Parse(src)
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*cells), "ns/cell")
+		})
+	}
+}
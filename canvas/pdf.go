@@ -0,0 +1,162 @@
+package canvas
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// writePDF writes the recorded drawing operations as a single page PDF document. Like in the
+// SVG output, the page size is scaled while the drawing keeps its coordinates, and the texts
+// are converted into glyph outlines. The hyperlinks are link annotations covering the linked
+// figures. The title and the description are stored in the document information.
+func writePDF(w io.Writer, rec *recorder, width, height int, scale float64, background, title, desc string) error {
+	pageWidth, pageHeight := float64(width)*scale, float64(height)*scale
+
+	// The drawing coordinates have the Y axis pointing down, unlike the PDF ones.
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "%s 0 0 %s 0 %s cm\n1 J 1 j\n", num(scale), num(-scale), num(pageHeight))
+	fmt.Fprintf(&content, "%s rg\n0 0 %d %d re f\n", pdfColor(background), width, height)
+	for _, o := range rec.ops {
+		color := pdfColor(o.color)
+		switch o.kind {
+		case strokeOp:
+			fmt.Fprintf(&content, "%s RG %s w\n", color, num(o.width))
+			for _, c := range o.curves {
+				fmt.Fprintf(&content, "%s %s m %s %s %s %s %s %s c\n", num(c.x0), num(c.y0),
+					num(c.x1), num(c.y1), num(c.x2), num(c.y2), num(c.x3), num(c.y3))
+			}
+			content.WriteString("S\n")
+		case dotOp:
+			// The circle is drawn with four Bézier curves.
+			const k = 0.5523
+			x, y, r := o.x, o.y, o.r
+			fmt.Fprintf(&content, "%s rg\n%s %s m\n", color, num(x+r), num(y))
+			for _, c := range [][6]float64{
+				{x + r, y + k*r, x + k*r, y + r, x, y + r},
+				{x - k*r, y + r, x - r, y + k*r, x - r, y},
+				{x - r, y - k*r, x - k*r, y - r, x, y - r},
+				{x + k*r, y - r, x + r, y - k*r, x + r, y},
+			} {
+				fmt.Fprintf(&content, "%s %s %s %s %s %s c\n", num(c[0]), num(c[1]), num(c[2]), num(c[3]), num(c[4]), num(c[5]))
+			}
+			content.WriteString("f\n")
+		case textOp:
+			// The color cannot be set inside the path, so it's set even if the text has no glyphs.
+			fmt.Fprintf(&content, "%s rg\n", color)
+			path := pdfPath{out: &content}
+			if glyphOutlines(o, &path); path.used {
+				content.WriteString("f\n")
+			}
+		case fillOp:
+			fmt.Fprintf(&content, "%s rg\n%s %s m\n", color, num(o.curves[0].x0), num(o.curves[0].y0))
+			for _, c := range o.curves {
+				fmt.Fprintf(&content, "%s %s %s %s %s %s c\n", num(c.x1), num(c.y1), num(c.x2), num(c.y2), num(c.x3), num(c.y3))
+			}
+			content.WriteString("h f\n")
+		}
+	}
+
+	var stream bytes.Buffer
+	zw := zlib.NewWriter(&stream)
+	zw.Write(content.Bytes())
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("error encoding the PDF document: %w", err)
+	}
+
+	// The objects are numbered from 1: the catalog, the page tree, the page, its content,
+	// the document information and the link annotations.
+	var annots []string
+	for i := range rec.links {
+		annots = append(annots, fmt.Sprintf("%d 0 R", 6+i))
+	}
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << >> /Contents 4 0 R /Annots [%s] >>",
+			num(pageWidth), num(pageHeight), strings.Join(annots, " ")),
+		fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.Bytes()),
+		fmt.Sprintf("<< /Title %s /Subject %s /Producer %s >>", pdfText(title), pdfText(desc), pdfText("diagram")),
+	}
+	for _, l := range rec.links {
+		// The annotation rectangles are given in the page coordinates.
+		objects = append(objects, fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect [%s %s %s %s] /Border [0 0 0] "+
+			"/A << /S /URI /URI <%s> >> >>", num(l.x0*scale), num(pageHeight-l.y1*scale), num(l.x1*scale),
+			num(pageHeight-l.y0*scale), hex.EncodeToString([]byte(l.url))))
+	}
+
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = doc.Len()
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	if _, err := w.Write(doc.Bytes()); err != nil {
+		return fmt.Errorf("error encoding the PDF document: %w", err)
+	}
+	return nil
+}
+
+// pdfPath writes the glyph contours as PDF path operators. The quadratic curves
+// are written as the equivalent cubic ones, which are the only curves of PDF.
+type pdfPath struct {
+	out          *bytes.Buffer
+	used         bool
+	lastX, lastY float64
+}
+
+func (p *pdfPath) moveTo(x, y float64) {
+	fmt.Fprintf(p.out, "%s %s m\n", num(x), num(y))
+	p.used, p.lastX, p.lastY = true, x, y
+}
+
+func (p *pdfPath) lineTo(x, y float64) {
+	fmt.Fprintf(p.out, "%s %s l\n", num(x), num(y))
+	p.lastX, p.lastY = x, y
+}
+
+func (p *pdfPath) quadTo(x1, y1, x, y float64) {
+	fmt.Fprintf(p.out, "%s %s %s %s %s %s c\n", num(p.lastX+2*(x1-p.lastX)/3), num(p.lastY+2*(y1-p.lastY)/3),
+		num(x+2*(x1-x)/3), num(y+2*(y1-y)/3), num(x), num(y))
+	p.lastX, p.lastY = x, y
+}
+
+func (p *pdfPath) close() { p.out.WriteString("h\n") }
+
+// pdfColor returns the PDF operands of the color given as #RGB or #RRGGBB. Black is returned for the other colors.
+func pdfColor(color string) string {
+	hexColor := strings.TrimPrefix(color, "#")
+	if len(hexColor) == 3 {
+		hexColor = string([]byte{hexColor[0], hexColor[0], hexColor[1], hexColor[1], hexColor[2], hexColor[2]})
+	}
+	v, err := strconv.ParseUint(hexColor, 16, 32)
+	if len(hexColor) != 6 || err != nil {
+		return "0 0 0"
+	}
+	channel := func(shift uint) string { return num(float64(v>>shift&0xff) / 255) }
+	return channel(16) + " " + channel(8) + " " + channel(0)
+}
+
+// pdfText returns the text as a PDF string encoded in UTF-16, with its byte order mark.
+func pdfText(s string) string {
+	var buf bytes.Buffer
+	buf.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&buf, "%04X", u)
+	}
+	buf.WriteString(">")
+	return buf.String()
+}
@@ -0,0 +1,105 @@
+package canvas
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePDF(t *testing.T) {
+	src := "# Services\n" +
+		"\n" +
+		"+----------------------+\n" +
+		"| [auth](https://a.io) |---->  [db]\n" +
+		"+----------------------+\n" +
+		"\n" +
+		"[db]: mailto:ops@example.com\n"
+
+	fonts, err := DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_, err = Render(context.Background(), strings.NewReader(src), &buf, Options{Format: PDF, Fonts: fonts, Scale: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.Bytes()
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatalf("missing PDF header or trailer")
+	}
+
+	// The cross-reference table points to the objects.
+	m := regexp.MustCompile(`(?s)startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	table := regexp.MustCompile(`^xref\n0 (\d+)\n0000000000 65535 f \n`).FindSubmatch(doc[xref:])
+	if table == nil {
+		t.Fatalf("no cross-reference table at offset %d", xref)
+	}
+	size, _ := strconv.Atoi(string(table[1]))
+	entries := doc[xref+len(table[0]):]
+	for i := 1; i < size; i++ {
+		offset, err := strconv.Atoi(string(entries[(i-1)*20 : (i-1)*20+10]))
+		if err != nil {
+			t.Fatalf("invalid cross-reference entry %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("%d 0 obj\n", i); !bytes.HasPrefix(doc[offset:], []byte(want)) {
+			t.Errorf("object %d is not at offset %d", i, offset)
+		}
+	}
+
+	// The page content draws the glyphs and the lines.
+	m = regexp.MustCompile(`(?s)/Length (\d+) /Filter /FlateDecode >>\nstream\n`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("missing content stream")
+	}
+	start := bytes.Index(doc, m[0]) + len(m[0])
+	length, _ := strconv.Atoi(string(m[1]))
+	zr, err := zlib.NewReader(bytes.NewReader(doc[start : start+length]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, operator := range []string{" cm\n", " m\n", " c\n", "S\n", "f\n"} {
+		if !bytes.Contains(content, []byte(operator)) {
+			t.Errorf("the content has no %q operator", strings.TrimSpace(operator))
+		}
+	}
+
+	var links []string
+	for _, m := range regexp.MustCompile(`/Subtype /Link /Rect \[[\d. ]+\] /Border \[0 0 0\] /A << /S /URI /URI <([0-9a-f]+)> >>`).FindAllSubmatch(doc, -1) {
+		url, err := hex.DecodeString(string(m[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, string(url))
+	}
+	if want := []string{"https://a.io", "mailto:ops@example.com"}; !slices.Equal(links, want) {
+		t.Errorf("got links %q, want %q", links, want)
+	}
+	if !bytes.Contains(doc, []byte("/Title "+pdfText("Services"))) {
+		t.Error("missing document title")
+	}
+}
+
+func TestPDFColor(t *testing.T) {
+	for color, want := range map[string]string{"#fff": "1 1 1", "#FF0000": "1 0 0", "#1e1e1e": "0.12 0.12 0.12", "red": "0 0 0"} {
+		if got := pdfColor(color); got != want {
+			t.Errorf("pdfColor(%q) = %q, want %q", color, got, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package canvas
+
+import (
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+)
+
+// opKind defines the type of a recorded drawing operation.
+type opKind int
+
+const (
+	strokeOp opKind = iota
+	dotOp
+	textOp
+	fillOp
+)
+
+// cubic is a cubic Bézier curve.
+type cubic struct {
+	x0, y0, x1, y1, x2, y2, x3, y3 float64
+}
+
+// split returns the part of the curve between its start and the parameter t, using de Casteljau's algorithm.
+func (c cubic) split(t float64) cubic {
+	lerp := func(a, b float64) float64 { return a + (b-a)*t }
+
+	x01, y01 := lerp(c.x0, c.x1), lerp(c.y0, c.y1)
+	x12, y12 := lerp(c.x1, c.x2), lerp(c.y1, c.y2)
+	x23, y23 := lerp(c.x2, c.x3), lerp(c.y2, c.y3)
+	x012, y012 := lerp(x01, x12), lerp(y01, y12)
+	x123, y123 := lerp(x12, x23), lerp(y12, y23)
+	x0123, y0123 := lerp(x012, x123), lerp(y012, y123)
+
+	return cubic{c.x0, c.y0, x01, y01, x012, y012, x0123, y0123}
+}
+
+// op is a drawing operation recorded by the canvas: a stroked path, a dot, a text run or a filled area.
+type op struct {
+	kind  opKind
+	color string
+
+	// The stroked path and its width, or the outline of the filled area.
+	curves []cubic
+	width  float64
+
+	// The position of the dot center, or of the text baseline start.
+	x, y float64
+	r    float64
+
+	// The text run with the font used for drawing it.
+	text string
+	font *truetype.Font
+	face font.Face
+	size float64
+}
+
+// recorder collects the drawing operations of the canvas in the order they are made,
+// so they can be written as vector graphics or replayed as an animation.
+type recorder struct {
+	ops   []op
+	path  []cubic
+	color string
+	// links holds the hyperlinks of the figures, which are not drawing operations.
+	links []link
+}
+
+// stroke records the current path as a stroke of the given width, and starts a new path.
+func (r *recorder) stroke(width float64) {
+	if len(r.path) == 0 {
+		return
+	}
+	r.ops = append(r.ops, op{kind: strokeOp, color: r.color, curves: r.path, width: width})
+	r.path = nil
+}
+
+// dot records a filled circle.
+func (r *recorder) dot(x, y, radius float64) {
+	r.ops = append(r.ops, op{kind: dotOp, color: r.color, x: x, y: y, r: radius})
+}
+
+// text records a text run, with the baseline starting at (x, y).
+func (r *recorder) text(f *truetype.Font, face font.Face, size float64, text string, x, y float64) {
+	r.ops = append(r.ops, op{kind: textOp, color: r.color, x: x, y: y, text: text, font: f, face: face, size: size})
+}
+
+// fill records a filled area having the outline made of the curves.
+func (r *recorder) fill(curves []cubic) {
+	r.ops = append(r.ops, op{kind: fillOp, color: r.color, curves: curves})
+}
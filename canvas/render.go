@@ -0,0 +1,284 @@
+package canvas
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"strings"
+
+	"github.com/fogleman/gg"
+)
+
+// Format defines the encoding of the rendered diagram.
+type Format string
+
+// The supported output formats.
+const (
+	PNG  Format = "png"
+	PNG8 Format = "png8" // PNG with a palette of at most 256 colors
+	JPEG Format = "jpeg"
+	GIF  Format = "gif"
+	SVG  Format = "svg"
+	PDF  Format = "pdf"
+)
+
+// Formats lists the supported output formats.
+var Formats = []Format{PNG, PNG8, JPEG, GIF, SVG, PDF}
+
+// mimeTypes maps the output formats to their MIME types.
+var mimeTypes = map[Format]string{
+	PNG:  "image/png",
+	PNG8: "image/png",
+	JPEG: "image/jpeg",
+	GIF:  "image/gif",
+	SVG:  "image/svg+xml",
+	PDF:  "application/pdf",
+}
+
+// MIMEType returns the MIME type of the images encoded in the format.
+func (f Format) MIMEType() string {
+	return mimeTypes[f]
+}
+
+// formatAliases maps the alternative format names, like the file extensions, to the formats.
+var formatAliases = map[string]Format{
+	"jpg": JPEG,
+}
+
+// ParseFormat returns the output format with the given name.
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToLower(name)
+	if f, ok := formatAliases[name]; ok {
+		return f, nil
+	}
+	for _, f := range Formats {
+		if name == string(f) {
+			return f, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported output format: %q", name)
+}
+
+// FormatOf returns the output format matching the extension of the file. It defaults to PNG.
+func FormatOf(path string) Format {
+	if f, err := ParseFormat(strings.TrimPrefix(filepath.Ext(path), ".")); err == nil {
+		return f
+	}
+	return PNG
+}
+
+// Theme defines the colors used for rendering a diagram.
+type Theme struct {
+	Background string
+	Foreground string
+	Muted      string
+}
+
+var (
+	// DefaultTheme draws black strokes on a white background.
+	DefaultTheme = Theme{Background: "#fff", Foreground: "#000", Muted: "#666"}
+	// DarkTheme draws light strokes on a dark background.
+	DarkTheme = Theme{Background: "#1e1e1e", Foreground: "#eee", Muted: "#999"}
+)
+
+// Themes maps the theme names to the supported themes.
+var Themes = map[string]Theme{
+	"default": DefaultTheme,
+	"light":   DefaultTheme,
+	"dark":    DarkTheme,
+}
+
+// Options defines the rendering options.
+type Options struct {
+	// Format is the output encoding. Defaults to PNG.
+	Format Format
+	// Quality is the quality of the JPEG images, between 1 and 100. Defaults to DefaultQuality.
+	Quality int
+	// Font holds the TTF/OTF data of the font used for the labels.
+	// When empty the embedded default font is used.
+	Font []byte
+	// Fonts is an already loaded font set. It takes precedence over Font.
+	Fonts *FontSet
+	// Seed initializes the randomness of the hand-drawn strokes, making the output reproducible.
+	// When zero a random seed is used.
+	Seed int64
+	// Scale multiplies the size of the output image. Defaults to 1.
+	Scale float64
+	// Theme defines the colors of the diagram. Defaults to DefaultTheme.
+	Theme *Theme
+	// Mode defines how Render interprets the ASCII art. Defaults to the free form diagrams.
+	Mode Mode
+	// Compat enables the conventions of another tool when Render parses the ASCII art.
+	Compat Compat
+	// MaxPixels limits the size of the image, width times height, including the scale.
+	// The larger diagrams are rejected with ErrImageTooLarge before drawing them.
+	// When zero the size is not limited.
+	MaxPixels int64
+	// Description is the text description embedded in the SVG, PDF and PNG images.
+	// When empty it's computed by Describe, which lets the callers describing
+	// the diagram on their own avoid computing it twice.
+	Description string
+}
+
+// ErrImageTooLarge is returned when the rendered image would exceed the MaxPixels option.
+var ErrImageTooLarge = errors.New("image too large")
+
+// LineWidth defines the stroke width of the lines.
+const LineWidth float64 = 3
+
+// Render parses the ASCII art read from r and draws it as a hand drawn diagram.
+// The resulting image is returned and, if w is not nil, it's also encoded into w
+// in the requested format. Render does not access the file system.
+// Each call draws onto its own canvas, so Render can be called from multiple goroutines,
+// even if they share the same font set.
+func Render(ctx context.Context, r io.Reader, w io.Writer, opts Options) (image.Image, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the diagram: %w", err)
+	}
+
+	diagram := &Diagram{Mode: opts.Mode, Compat: opts.Compat}
+	scene := diagram.ParseASCIIArt(strings.ReplaceAll(string(content), "\r\n", "\n"))
+
+	return RenderScene(ctx, scene, w, opts)
+}
+
+// RenderScene draws the figures of an already parsed or programmatically built scene.
+// The resulting image is returned and, if w is not nil, it's also encoded into w.
+// For the SVG and PDF formats the figures are encoded as vector graphics, while the returned image is their rasterization.
+// The SVG, PDF and PNG images include the title and the description of the diagram, returned by Title and Describe,
+// unless the description is given by the options.
+func RenderScene(ctx context.Context, scene *Scene, w io.Writer, opts Options) (image.Image, error) {
+	var rec *recorder
+	if opts.Format == SVG || opts.Format == PDF {
+		rec = &recorder{}
+	}
+	canvas, err := drawScene(ctx, scene, opts, rec)
+	if err != nil {
+		return nil, err
+	}
+	img := canvas.Image()
+	// The description is costly for the large diagrams, so it's not started after the deadline.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if w != nil {
+		// The vector images and the PNG images embed the text description of the diagram, computed once.
+		description := func() string {
+			if opts.Description != "" {
+				return opts.Description
+			}
+			return Describe(scene)
+		}
+		switch opts.Format {
+		case SVG:
+			width, height := bounds(scene)
+			err = writeSVG(w, rec, width, height, canvas.scale, canvas.theme.Background, Title(scene), description())
+		case PDF:
+			width, height := bounds(scene)
+			err = writePDF(w, rec, width, height, canvas.scale, canvas.theme.Background, Title(scene), description())
+		case "", PNG, PNG8:
+			var buf bytes.Buffer
+			if err = Encode(&buf, img, opts); err != nil {
+				break
+			}
+			// The encoding of the large images takes a while, so the deadline is checked again before the description.
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			if _, err = w.Write(addPNGText(buf.Bytes(), Title(scene), description())); err != nil {
+				err = fmt.Errorf("error writing the PNG image: %w", err)
+			}
+		default:
+			err = Encode(w, img, opts)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// drawScene draws the scene figures onto a new canvas and returns it.
+// The drawing operations are recorded into rec, if it's not nil.
+func drawScene(ctx context.Context, scene *Scene, opts Options, rec *recorder) (*Canvas, error) {
+	fonts, err := opts.fontSet()
+	if err != nil {
+		return nil, err
+	}
+
+	scale := opts.Scale
+	if scale <= 0 {
+		scale = 1
+	}
+	width, height := bounds(scene)
+
+	w, h := int(float64(width)*scale), int(float64(height)*scale)
+	if opts.MaxPixels > 0 && int64(w)*int64(h) > opts.MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels exceed the limit of %d", ErrImageTooLarge, w, h, opts.MaxPixels)
+	}
+	dc := gg.NewContext(w, h)
+	dc.Scale(scale, scale)
+
+	canvas := NewCanvas(dc, fonts, LineWidth)
+	canvas.scale = scale
+	if opts.Theme != nil {
+		canvas.theme = *opts.Theme
+	}
+	if opts.Seed != 0 {
+		canvas.rnd = rand.New(rand.NewSource(opts.Seed))
+	}
+
+	canvas.rec = rec
+
+	canvas.DrawRectangle(0, 0, float64(width), float64(height))
+	canvas.SetHexColor(canvas.theme.Background)
+	canvas.Fill()
+
+	var boxes *boxIndex
+	if rec != nil {
+		boxes = newBoxIndex(scene)
+	}
+	for _, fig := range scene.Figures {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fig.Draw(canvas)
+		if rec != nil {
+			if l, ok := figureLink(boxes, fig); ok {
+				rec.links = append(rec.links, l)
+			}
+		}
+	}
+	return canvas, nil
+}
+
+// fontSet returns the font set defined by the options.
+func (opts Options) fontSet() (*FontSet, error) {
+	switch {
+	case opts.Fonts != nil:
+		return opts.Fonts, nil
+	case len(opts.Font) > 0:
+		f, err := ParseFont(opts.Font)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse the font: %w", err)
+		}
+		return newFontSet(f), nil
+	}
+	return DefaultFontSet()
+}
+
+// bounds returns the size in pixels of the area covered by the scene.
+func bounds(scene *Scene) (width, height int) {
+	r := scene.Bounds()
+	width = int(float64(r.Max.X)*CellSize + CellSize/2)
+	height = int(float64(r.Max.Y)*CellSize + CellSize/2)
+
+	return max(width, int(CellSize)), max(height, int(CellSize))
+}
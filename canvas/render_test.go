@@ -0,0 +1,67 @@
+package canvas
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testDiagram = `
++-------------+          +------------+
+| # Client    |--------->| ` + "`server`" + `   |
++-------------+  request +------------+
+       ^                        |
+       |       response         |
+       +<~~~~~~~~~~~~~~~~~~~~~~~+
+`
+
+// TestRenderConcurrent renders the same diagram from multiple goroutines sharing one font set.
+// Run it with the race detector: go test -race ./canvas
+func TestRenderConcurrent(t *testing.T) {
+	fonts, err := DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	render := func(format Format) ([]byte, error) {
+		var buf bytes.Buffer
+		opts := Options{Format: format, Fonts: fonts, Seed: 1}
+		_, err := Render(context.Background(), strings.NewReader(testDiagram), &buf, opts)
+		return buf.Bytes(), err
+	}
+
+	formats := []Format{PNG, SVG}
+	want := make(map[Format][]byte)
+	for _, format := range formats {
+		if want[format], err = render(format); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*len(formats))
+	for i := 0; i < workers; i++ {
+		for _, format := range formats {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got, err := render(format)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(got, want[format]) {
+					t.Errorf("concurrent %s rendering differs from the sequential one", format)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,366 @@
+package canvas
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mode defines how the figures of the ASCII art are interpreted.
+type Mode string
+
+const (
+	// FreeFormMode draws the figures as they are in the ASCII art.
+	FreeFormMode Mode = ""
+	// SequenceMode recognizes the participants, the lifelines and the messages of the sequence diagrams.
+	SequenceMode Mode = "sequence"
+)
+
+// ParseMode returns the mode with the given name. The empty name denotes the free form mode.
+func ParseMode(name string) (Mode, error) {
+	switch m := Mode(strings.ToLower(name)); m {
+	case FreeFormMode, SequenceMode:
+		return m, nil
+	}
+	return "", fmt.Errorf("unsupported diagram mode: %q", name)
+}
+
+// Activation defines the rows where a participant of a sequence diagram is active,
+// from the synchronous message it receives to its reply.
+type Activation struct {
+	Y0 int `json:"y0"`
+	Y1 int `json:"y1"`
+}
+
+// Lifeline defines the lifeline of a participant of a sequence diagram, going down from
+// (X, Y0) to (X, Y1). It's drawn dashed, with narrow bars over the activations of the participant.
+type Lifeline struct {
+	X           int          `json:"x"`
+	Y0          int          `json:"y0"`
+	Y1          int          `json:"y1"`
+	Activations []Activation `json:"activations,omitempty"`
+	Color       string       `json:"color,omitempty"`
+	Pos         Position     `json:"pos"`
+}
+
+// Kind implements the Figure interface.
+func (l *Lifeline) Kind() FigureKind { return LifelineKind }
+
+// Bounds implements the Figure interface.
+func (l *Lifeline) Bounds() image.Rectangle {
+	return image.Rect(l.X, l.Y0, l.X+1, l.Y1+1)
+}
+
+func (l *Lifeline) String() string {
+	return fmt.Sprintf("%s\tlifeline\t(%d,%d) -> (%d,%d) %d activations", l.Pos, l.X, l.Y0, l.X, l.Y1, len(l.Activations))
+}
+
+// Draw draws the dashed lifeline, and the activation bars over it. The nested activations
+// are shifted to the right.
+func (l *Lifeline) Draw(ctx *Canvas) {
+	const half = CellSize / 4
+
+	ctx.setColor(l.Color)
+	ctx.SetLineWidth(ctx.lineWidth * ctx.scale)
+
+	// The outermost bars cover the lifeline, so it's interrupted by them.
+	levels := make([]int, len(l.Activations))
+	x, y := X(float64(l.X)), Y(float64(l.Y0))
+	for i, a := range l.Activations {
+		for _, outer := range l.Activations[:i] {
+			if outer.Y0 <= a.Y0 && a.Y1 <= outer.Y1 {
+				levels[i]++
+			}
+		}
+		if levels[i] == 0 {
+			if y1 := Y(float64(a.Y0)); y1 > y {
+				ctx.dashedLine(x, y, x, y1)
+			}
+			y = math.Max(y, Y(float64(a.Y1)))
+		}
+	}
+	if y1 := Y(float64(l.Y1)); y1 > y {
+		ctx.dashedLine(x, y, x, y1)
+	}
+	ctx.stroke()
+
+	for i, a := range l.Activations {
+		x0 := x - half + float64(levels[i])*half
+		x1 := x0 + 2*half
+		y0, y1 := Y(float64(a.Y0)), Y(float64(a.Y1))
+		ctx.moveTo(x0, y0)
+		ctx.lineTo(x1, y0)
+		ctx.lineTo(x1, y1)
+		ctx.lineTo(x0, y1)
+		ctx.lineTo(x0, y0)
+		ctx.stroke()
+	}
+}
+
+// message is a horizontal arrow going from a lifeline to another one.
+type message struct {
+	line     *Line
+	from, to int
+	reply    bool
+}
+
+// extractSequence converts the figures into a sequence diagram. The participants are the boxes
+// having a vertical line going down from their bottom edge, which becomes their lifeline.
+// The horizontal arrows between two lifelines are the messages: the ones drawn with `~` are
+// replies, and the calls getting a reply are synchronous, activating their receiver until the reply.
+// The labels written above the messages, or in the middle of them, are centered above the arrows,
+// and the ones written below the messages, unless they are right above the next message, are centered below them.
+func extractSequence(figures []Figure) []Figure {
+	scene := &Scene{Figures: figures}
+	g := NewGraph(scene)
+
+	var boxes []image.Rectangle
+	for _, node := range g.Nodes {
+		if node.Box {
+			boxes = append(boxes, node.Bounds)
+		}
+	}
+	onEdge := func(line *Line) bool {
+		for _, box := range boxes {
+			if onBoxEdge(line, box) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var vertical, horizontal []*Line
+	var texts []*Text
+	for _, fig := range figures {
+		switch fig := fig.(type) {
+		case *Line:
+			switch {
+			case onEdge(fig):
+			case fig.X0 == fig.X1:
+				vertical = append(vertical, fig)
+			case fig.Y0 == fig.Y1:
+				horizontal = append(horizontal, fig)
+			}
+		case *Text:
+			texts = append(texts, fig)
+		}
+	}
+
+	removed := make(map[Figure]bool)
+	replaced := make(map[Figure]Figure)
+
+	// Find the lifelines, made of the vertical lines following each other in the same column.
+	var lifelines []*Lifeline
+	for _, box := range boxes {
+		var top *Line
+		center := (box.Min.X + box.Max.X - 1) / 2
+		for _, line := range vertical {
+			y0 := min(line.Y0, line.Y1)
+			if removed[line] || line.X0 <= box.Min.X || line.X0 >= box.Max.X-1 || y0 != box.Max.Y-1 && y0 != box.Max.Y {
+				continue
+			}
+			if top == nil || abs(line.X0-center) < abs(top.X0-center) {
+				top = line
+			}
+		}
+		if top == nil {
+			continue
+		}
+		lifeline := &Lifeline{X: top.X0, Y0: box.Max.Y - 1, Y1: max(top.Y0, top.Y1), Color: top.Color, Pos: top.Pos}
+		replaced[top] = lifeline
+		removed[top] = true
+		for found := true; found; {
+			found = false
+			for _, line := range vertical {
+				if !removed[line] && line.X0 == lifeline.X && min(line.Y0, line.Y1) == lifeline.Y1+1 {
+					lifeline.Y1 = max(line.Y0, line.Y1)
+					removed[line] = true
+					found = true
+				}
+			}
+		}
+		lifelines = append(lifelines, lifeline)
+	}
+	if len(lifelines) < 2 {
+		return figures
+	}
+
+	lifelineAt := func(x, y int) (int, bool) {
+		for i, l := range lifelines {
+			if abs(l.X-x) <= 1 && l.Y0 < y && y <= l.Y1 {
+				return i, true
+			}
+		}
+		return 0, false
+	}
+
+	// The segments of a message interrupted by its label are joined.
+	slices.SortStableFunc(horizontal, func(a, b *Line) int {
+		return cmp.Or(cmp.Compare(a.Y0, b.Y0), cmp.Compare(min(a.X0, a.X1), min(b.X0, b.X1)))
+	})
+	var messages []message
+	labels := make(map[*Text]bool)
+	for i := 0; i < len(horizontal); i++ {
+		first := horizontal[i]
+		if removed[first] {
+			continue
+		}
+		segments := []*Line{first}
+		var inline []*Text
+		x0, start, x1, end := ends(first)
+		for j := i + 1; j < len(horizontal) && end == NoEnding; j++ {
+			next := horizontal[j]
+			nx0, nstart, nx1, nend := ends(next)
+			if next.Y0 != first.Y0 || nstart != NoEnding {
+				break
+			}
+			var between []*Text
+			for _, text := range texts {
+				if text.Y == first.Y0 && x1 < text.X && text.X+utf8.RuneCountInString(text.Text) <= nx0 {
+					between = append(between, text)
+				}
+			}
+			if len(between) == 0 {
+				break
+			}
+			segments = append(segments, next)
+			inline = append(inline, between...)
+			x1, end = nx1, nend
+			i = j
+		}
+
+		left, lok := lifelineAt(x0, first.Y0)
+		right, rok := lifelineAt(x1, first.Y0)
+		if !lok || !rok || left == right || (start == Arrow) == (end == Arrow) {
+			continue
+		}
+
+		line := &Line{X0: lifelines[left].X, Y0: first.Y0, X1: lifelines[right].X, Y1: first.Y0, Color: first.Color, Pos: first.Pos}
+		msg := message{line: line, from: left, to: right}
+		if start == Arrow {
+			line.Start = Arrow
+			msg.from, msg.to = right, left
+		} else {
+			line.End = Arrow
+		}
+		for _, segment := range segments {
+			removed[segment] = true
+			if segment.Color == "#666" {
+				msg.reply = true
+			}
+		}
+		line.Dashed = msg.reply
+		replaced[first] = line
+		messages = append(messages, msg)
+
+		// Use the label placed in the middle of the arrow, the one right above it or the one right below it.
+		rowLabel := func(y int) []*Text {
+			var label []*Text
+			for _, text := range texts {
+				if text.Y == y && !labels[text] && lifelines[min(left, right)].X < text.X &&
+					text.X+utf8.RuneCountInString(text.Text) <= lifelines[max(left, right)].X {
+					label = append(label, text)
+				}
+			}
+			return label
+		}
+		label, y := inline, first.Y0-1
+		if len(label) == 0 {
+			label = rowLabel(first.Y0 - 1)
+		}
+		if len(label) == 0 {
+			label, y = rowLabel(first.Y0+1), first.Y0+1
+			if aboveLine(label, horizontal) {
+				continue
+			}
+		}
+		if len(label) == 0 {
+			continue
+		}
+		words := make([]string, len(label))
+		for k, text := range label {
+			words[k] = text.Text
+			labels[text] = true
+			if k > 0 {
+				removed[text] = true
+			}
+		}
+		text := label[0]
+		text.Text = strings.Join(words, " ")
+		text.Y = y
+		lx, rx := min(line.X0, line.X1), max(line.X0, line.X1)
+		text.X = max(lx+1, (lx+rx-utf8.RuneCountInString(text.Text)+1)/2)
+	}
+
+	// Match the calls with the replies going back to the callers. The calls left
+	// without reply are asynchronous.
+	type call struct {
+		msg  *message
+		from int
+	}
+	pending := make([][]call, len(lifelines))
+	for i := range messages {
+		msg := &messages[i]
+		if !msg.reply {
+			pending[msg.to] = append(pending[msg.to], call{msg, msg.from})
+			continue
+		}
+		calls := pending[msg.from]
+		for k := len(calls) - 1; k >= 0; k-- {
+			if calls[k].from != msg.to {
+				continue
+			}
+			c := calls[k].msg.line
+			if c.End == Arrow {
+				c.End = Triangle
+			} else {
+				c.Start = Triangle
+			}
+			l := lifelines[msg.from]
+			l.Activations = append(l.Activations, Activation{Y0: c.Y0, Y1: msg.line.Y0})
+			pending[msg.from] = calls[:k]
+			break
+		}
+	}
+	for _, l := range lifelines {
+		slices.SortFunc(l.Activations, func(a, b Activation) int {
+			return cmp.Or(cmp.Compare(a.Y0, b.Y0), cmp.Compare(b.Y1, a.Y1))
+		})
+	}
+
+	var res []Figure
+	for _, fig := range figures {
+		if fig, ok := replaced[fig]; ok {
+			res = append(res, fig)
+		}
+		if !removed[fig] {
+			res = append(res, fig)
+		}
+	}
+	return res
+}
+
+// aboveLine reports whether any of the texts is written right above one of the horizontal lines.
+func aboveLine(texts []*Text, lines []*Line) bool {
+	for _, text := range texts {
+		for _, line := range lines {
+			x0, _, x1, _ := ends(line)
+			if line.Y0 == text.Y+1 && x0 < text.X+utf8.RuneCountInString(text.Text) && text.X <= x1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ends returns the left and the right end of the horizontal line, with their endings.
+func ends(line *Line) (x0 int, start Ending, x1 int, end Ending) {
+	if line.X0 > line.X1 {
+		return line.X1, line.End, line.X0, line.Start
+	}
+	return line.X0, line.Start, line.X1, line.End
+}
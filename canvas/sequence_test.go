@@ -0,0 +1,136 @@
+package canvas
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// participants is the head of the sequence diagrams of the tests, having the lifelines at the columns 2 and 12.
+// The messages start on the fifth row.
+const participants = "" +
+	"+---+     +---+\n" +
+	"| a |     | b |\n" +
+	"+---+     +---+\n" +
+	"  |         |\n"
+
+func TestParseSequence(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "asynchronous call",
+			src: participants +
+				"  |  get    |\n" +
+				"  |-------->|\n" +
+				"  |         |\n",
+			want: []string{"lifeline 2 2-6", "lifeline 12 2-6", "message 2->12 arrow", `label "get" (6,4)`},
+		},
+		{
+			name: "call and reply",
+			src: participants +
+				"  |  get    |\n" +
+				"  |-------->|\n" +
+				"  |<~~~~~~~~|\n" +
+				"  |         |\n",
+			want: []string{
+				"lifeline 2 2-7", "lifeline 12 2-7 active 5-6",
+				"message 2->12 triangle", "message 12->2 arrow dashed", `label "get" (6,4)`,
+			},
+		},
+		{
+			name: "nested activations",
+			src: participants +
+				"  |-------->|\n" +
+				"  |<--------|\n" +
+				"  |~~~~~~~~>|\n" +
+				"  |<~~~~~~~~|\n" +
+				"  |         |\n",
+			want: []string{
+				"lifeline 2 2-8 active 5-6", "lifeline 12 2-8 active 4-7",
+				"message 2->12 triangle", "message 12->2 triangle", "message 2->12 arrow dashed", "message 12->2 arrow dashed",
+			},
+		},
+		{
+			name: "label in the middle",
+			src: participants +
+				"  |--send-->|\n" +
+				"  |         |\n",
+			want: []string{"lifeline 2 2-5", "lifeline 12 2-5", "message 2->12 arrow", `label "send" (5,3)`},
+		},
+		{
+			name: "label below",
+			src: participants +
+				"  |-------->|\n" +
+				"  | async   |\n",
+			want: []string{"lifeline 2 2-5", "lifeline 12 2-5", "message 2->12 arrow", `label "async" (5,5)`},
+		},
+		{
+			name: "label below the reply",
+			src: participants +
+				"  |-------->|\n" +
+				"  |<~~~~~~~~|\n" +
+				"  |   ok    |\n",
+			want: []string{
+				"lifeline 2 2-6", "lifeline 12 2-6 active 4-5",
+				"message 2->12 triangle", "message 12->2 arrow dashed", `label "ok" (6,6)`,
+			},
+		},
+		{
+			name: "label above the next message",
+			src: participants +
+				"  |-------->|\n" +
+				"  |  next   |\n" +
+				"  |-------->|\n",
+			want: []string{"lifeline 2 2-6", "lifeline 12 2-6", "message 2->12 arrow", "message 2->12 arrow", `label "next" (5,5)`},
+		},
+		{
+			name: "arrow between the lifelines",
+			src: participants +
+				"  |  --->   |\n" +
+				"  |         |\n",
+			want: []string{"lifeline 2 2-5", "lifeline 12 2-5", "message 5->9 arrow"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scene, _ := (&Diagram{Mode: SequenceMode}).Parse(tt.src)
+
+			var got []string
+			for _, fig := range scene.Figures {
+				switch fig := fig.(type) {
+				case *Lifeline:
+					s := fmt.Sprintf("lifeline %d %d-%d", fig.X, fig.Y0, fig.Y1)
+					for _, a := range fig.Activations {
+						s += fmt.Sprintf(" active %d-%d", a.Y0, a.Y1)
+					}
+					got = append(got, s)
+				case *Line:
+					// The horizontal lines below the participants, whether they are messages or not.
+					if fig.Y0 != fig.Y1 || fig.Y0 < 3 {
+						continue
+					}
+					from, to, ending := fig.X0, fig.X1, fig.End
+					if fig.Start != NoEnding {
+						from, to, ending = fig.X1, fig.X0, fig.Start
+					}
+					s := fmt.Sprintf("message %d->%d %s", from, to, ending)
+					if fig.Dashed {
+						s += " dashed"
+					}
+					got = append(got, s)
+				case *Text:
+					if fig.Y > 2 {
+						got = append(got, fmt.Sprintf("label %q (%d,%d)", fig.Text, fig.X, fig.Y))
+					}
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package canvas
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"unicode/utf8"
+)
+
+// ShapeType defines the outline of a shape.
+type ShapeType string
+
+// The shapes which can replace a box.
+const (
+	Database    ShapeType = "db"
+	Cloud       ShapeType = "cloud"
+	Actor       ShapeType = "actor"
+	Document    ShapeType = "doc"
+	Diamond     ShapeType = "diamond"
+	InputOutput ShapeType = "io"
+	Ellipse     ShapeType = "ellipse"
+)
+
+// UnmarshalJSON implements the json.Unmarshaler interface, rejecting the unknown shape types.
+func (t *ShapeType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	if _, ok := shapeDrawers[ShapeType(name)]; !ok {
+		return fmt.Errorf("unknown shape type %q", name)
+	}
+	*t = ShapeType(name)
+	return nil
+}
+
+// shapeTags holds the shapes which can replace a box, marked by a tag made of their type, like {db}.
+var shapeTags = map[string]ShapeType{
+	string(Database):    Database,
+	string(Cloud):       Cloud,
+	string(Actor):       Actor,
+	string(Document):    Document,
+	string(Diamond):     Diamond,
+	string(InputOutput): InputOutput,
+	string(Ellipse):     Ellipse,
+}
+
+// shapeTag matches the tag placed inside a box, alone or in front of its label.
+var shapeTag = regexp.MustCompile(`^\{([a-z]+)\}(?: |$)`)
+
+// Shape defines a shape drawn inside the rectangle having the top left corner at (X0, Y0)
+// and the bottom right corner at (X1, Y1), filled with the Fill color if it's set. In the ASCII
+// art it's a box marked by a tag, like {db}, and its position is the position of the tag.
+type Shape struct {
+	Type  ShapeType `json:"type"`
+	X0    int       `json:"x0"`
+	Y0    int       `json:"y0"`
+	X1    int       `json:"x1"`
+	Y1    int       `json:"y1"`
+	Color string    `json:"color,omitempty"`
+	Fill  string    `json:"fill,omitempty"`
+	Pos   Position  `json:"pos"`
+}
+
+// Kind implements the Figure interface.
+func (shape *Shape) Kind() FigureKind { return ShapeKind }
+
+// Bounds implements the Figure interface.
+func (shape *Shape) Bounds() image.Rectangle {
+	return image.Rect(shape.X0, shape.Y0, shape.X1+1, shape.Y1+1)
+}
+
+func (shape *Shape) String() string {
+	return fmt.Sprintf("%s\tshape\t(%d,%d) (%d,%d) %s", shape.Pos, shape.X0, shape.Y0, shape.X1, shape.Y1, shape.Type)
+}
+
+// Tag returns the tag marking the boxes replaced by the shape.
+func (shape *Shape) Tag() string {
+	return "{" + string(shape.Type) + "}"
+}
+
+// extractShapes replaces the boxes marked by one of the shape tags with the shapes. The tag is
+// removed from the labels, and the lines lying on the box edges are replaced by the shape.
+func extractShapes(figures []Figure, tags map[string]ShapeType) []Figure {
+	index := newBoxIndex(&Scene{Figures: figures})
+	removed := make(map[Figure]bool)
+	shapes := make(map[Figure]*Shape)
+
+	for _, fig := range figures {
+		text, ok := fig.(*Text)
+		if !ok {
+			continue
+		}
+		m := shapeTag.FindStringSubmatch(text.Text)
+		if m == nil {
+			continue
+		}
+		typ, ok := tags[m[1]]
+		if !ok {
+			continue
+		}
+		box, ok := index.enclosing(text.Bounds())
+		if !ok {
+			continue
+		}
+
+		shape := &Shape{Type: typ, X0: box.Min.X, Y0: box.Min.Y, X1: box.Max.X - 1, Y1: box.Max.Y - 1, Pos: text.Pos}
+		var first Figure
+		for _, other := range figures {
+			line, ok := other.(*Line)
+			if !ok || removed[line] || !onBoxEdge(line, box) {
+				continue
+			}
+			if first == nil {
+				first = line
+				shape.Color = line.Color
+			}
+			removed[line] = true
+		}
+		if first == nil {
+			continue
+		}
+		shapes[first] = shape
+
+		if rest := text.Text[len(m[0]):]; rest != "" {
+			text.Text = rest
+			text.X += utf8.RuneCountInString(m[0])
+		} else {
+			removed[text] = true
+		}
+	}
+	if len(removed) == 0 {
+		return figures
+	}
+
+	// The shape takes the place of the first line of the box.
+	var res []Figure
+	for _, fig := range figures {
+		if shape, ok := shapes[fig]; ok {
+			res = append(res, shape)
+		}
+		if !removed[fig] {
+			res = append(res, fig)
+		}
+	}
+	return res
+}
+
+// onBoxEdge reports whether the line lies on one of the edges of the box.
+func onBoxEdge(line *Line, box image.Rectangle) bool {
+	x0, x1 := min(line.X0, line.X1), max(line.X0, line.X1)
+	y0, y1 := min(line.Y0, line.Y1), max(line.Y0, line.Y1)
+	if x0 < box.Min.X || x1 >= box.Max.X || y0 < box.Min.Y || y1 >= box.Max.Y {
+		return false
+	}
+	return y0 == y1 && (y0 == box.Min.Y || y0 == box.Max.Y-1) ||
+		x0 == x1 && (x0 == box.Min.X || x0 == box.Max.X-1)
+}
+
+// Draw draws the outline of the shape with the given color.
+func (shape *Shape) Draw(ctx *Canvas) {
+	drawer, ok := shapeDrawers[shape.Type]
+	if !ok {
+		return
+	}
+	ctx.SetLineWidth(ctx.lineWidth * ctx.scale)
+
+	b := newShapeBox(shape)
+	if shape.Fill != "" {
+		// The area is filled piece by piece, approximating the outline.
+		ctx.setColor(shape.Fill)
+		drawer.fill(ctx, b)
+	}
+	ctx.setColor(shape.Color)
+	drawer.outline(ctx, b)
+	ctx.stroke()
+}
+
+// shapeDrawer draws one type of shape.
+type shapeDrawer interface {
+	// fill fills the area of the shape.
+	fill(ctx *Canvas, b shapeBox)
+	// outline adds the outline of the shape to the current path.
+	outline(ctx *Canvas, b shapeBox)
+}
+
+// shapeDrawers holds the drawers of the shape types.
+var shapeDrawers = map[ShapeType]shapeDrawer{
+	Database:    databaseDrawer{},
+	Cloud:       cloudDrawer{},
+	Actor:       actorDrawer{},
+	Document:    documentDrawer{},
+	Diamond:     diamondDrawer{},
+	InputOutput: ioDrawer{},
+	Ellipse:     ellipseDrawer{},
+}
+
+// shapeBox holds the geometry of the box a shape is drawn into, in canvas coordinates.
+type shapeBox struct {
+	x0, y0, x1, y1 float64
+	// cx and cy hold the center of the box.
+	cx, cy float64
+	w, h   float64
+}
+
+// newShapeBox returns the box the shape is drawn into.
+func newShapeBox(shape *Shape) shapeBox {
+	x0, y0 := X(float64(shape.X0)), Y(float64(shape.Y0))
+	x1, y1 := X(float64(shape.X1)), Y(float64(shape.Y1))
+	return shapeBox{
+		x0: x0, y0: y0, x1: x1, y1: y1,
+		cx: (x0 + x1) / 2, cy: (y0 + y1) / 2,
+		w: x1 - x0, h: y1 - y0,
+	}
+}
+
+// ellipse returns the closed path of the ellipse inscribed in the box.
+func (b shapeBox) ellipse() []cubic {
+	return arc(b.cx, b.cy, b.w/2, b.h/2, 0, 2*math.Pi)
+}
+
+// databaseDrawer draws a cylinder: the top ellipse, the sides and the front half of the bottom ellipse.
+type databaseDrawer struct{}
+
+// rim returns the vertical radius of the ellipses.
+func (databaseDrawer) rim(b shapeBox) float64 { return min(b.h/4, CellSize/2) }
+
+func (d databaseDrawer) fill(ctx *Canvas, b shapeBox) {
+	ry := d.rim(b)
+	ctx.fill(polygon(b.x0, b.y0+ry, b.x1, b.y0+ry, b.x1, b.y1-ry, b.x0, b.y1-ry))
+	ctx.fill(arc(b.cx, b.y0+ry, b.w/2, ry, 0, 2*math.Pi))
+	ctx.fill(arc(b.cx, b.y1-ry, b.w/2, ry, 0, 2*math.Pi))
+}
+
+func (d databaseDrawer) outline(ctx *Canvas, b shapeBox) {
+	ry := d.rim(b)
+	ctx.ellipse(b.cx, b.y0+ry, b.w/2, ry, 0, 2*math.Pi)
+	ctx.moveTo(b.x0, b.y0+ry)
+	ctx.lineTo(b.x0, b.y1-ry)
+	ctx.ellipse(b.cx, b.y1-ry, b.w/2, ry, math.Pi, 0)
+	ctx.lineTo(b.x1, b.y0+ry)
+}
+
+// cloudDrawer draws bumps placed around an ellipse, bulging outwards.
+type cloudDrawer struct{}
+
+func (cloudDrawer) fill(ctx *Canvas, b shapeBox) { ctx.fill(b.ellipse()) }
+
+func (cloudDrawer) outline(ctx *Canvas, b shapeBox) {
+	rx, ry := b.w/2*0.85, b.h/2*0.8
+	n := max(6, int(math.Round(math.Pi*(rx+ry)/(1.5*CellSize))))
+	point := func(i int) (float64, float64) {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		return b.cx + rx*math.Cos(a), b.cy + ry*math.Sin(a)
+	}
+	bulge := 0.6 * math.Pi * (rx + ry) / float64(n)
+	ctx.moveTo(point(0))
+	for i := 0; i < n; i++ {
+		ax, ay := point(i)
+		bx, by := point(i + 1)
+		adx, ady := unit(ax-b.cx, ay-b.cy)
+		bdx, bdy := unit(bx-b.cx, by-b.cy)
+		ctx.curveTo(ax+adx*bulge, ay+ady*bulge, bx+bdx*bulge, by+bdy*bulge, bx, by)
+	}
+}
+
+// actorDrawer draws a stick figure above the last row, which is left for the label.
+type actorDrawer struct{}
+
+// fill leaves the stick figure unfilled.
+func (actorDrawer) fill(ctx *Canvas, b shapeBox) {}
+
+func (actorDrawer) outline(ctx *Canvas, b shapeBox) {
+	bottom := b.y1 - 1.5*CellSize
+	if bottom-b.y0 < 2*CellSize {
+		bottom = b.y1
+	}
+	size := bottom - b.y0
+	r := min(size*0.15, b.w/4)
+	reach := min(size*0.25, b.w/2)
+	neck, hip := b.y0+2*r, b.y0+2*r+size*0.4
+	ctx.ellipse(b.cx, b.y0+r, r, r, -math.Pi/2, 3*math.Pi/2)
+	ctx.moveTo(b.cx, neck)
+	ctx.lineTo(b.cx, hip)
+	ctx.moveTo(b.cx-reach, neck+size*0.12)
+	ctx.lineTo(b.cx+reach, neck+size*0.12)
+	ctx.moveTo(b.cx-reach, bottom)
+	ctx.lineTo(b.cx, hip)
+	ctx.lineTo(b.cx+reach, bottom)
+}
+
+// documentDrawer draws a sheet having a wavy bottom edge.
+type documentDrawer struct{}
+
+// documentWave defines the height of the wave of the document's bottom edge.
+const documentWave = CellSize / 4
+
+func (documentDrawer) fill(ctx *Canvas, b shapeBox) {
+	ctx.fill(polygon(b.x0, b.y0, b.x1, b.y0, b.x1, b.y1-documentWave, b.x0, b.y1-documentWave))
+}
+
+func (documentDrawer) outline(ctx *Canvas, b shapeBox) {
+	ctx.moveTo(b.x0, b.y1-documentWave)
+	ctx.lineTo(b.x0, b.y0)
+	ctx.lineTo(b.x1, b.y0)
+	ctx.lineTo(b.x1, b.y1-documentWave)
+	ctx.curveTo(b.x1-b.w/3, b.y1+2*documentWave, b.x0+b.w/3, b.y1-4*documentWave, b.x0, b.y1-documentWave)
+}
+
+// diamondDrawer draws a rhombus touching the middle of the box edges.
+type diamondDrawer struct{}
+
+func (diamondDrawer) fill(ctx *Canvas, b shapeBox) {
+	ctx.fill(polygon(b.cx, b.y0, b.x1, b.cy, b.cx, b.y1, b.x0, b.cy))
+}
+
+func (diamondDrawer) outline(ctx *Canvas, b shapeBox) {
+	ctx.moveTo(b.cx, b.y0)
+	ctx.lineTo(b.x1, b.cy)
+	ctx.lineTo(b.cx, b.y1)
+	ctx.lineTo(b.x0, b.cy)
+	ctx.lineTo(b.cx, b.y0)
+}
+
+// ioDrawer draws a parallelogram leaning to the right.
+type ioDrawer struct{}
+
+// skew returns the horizontal offset of the parallelogram's top edge.
+func (ioDrawer) skew(b shapeBox) float64 { return min(b.w/4, CellSize) }
+
+func (d ioDrawer) fill(ctx *Canvas, b shapeBox) {
+	skew := d.skew(b)
+	ctx.fill(polygon(b.x0+skew, b.y0, b.x1, b.y0, b.x1-skew, b.y1, b.x0, b.y1))
+}
+
+func (d ioDrawer) outline(ctx *Canvas, b shapeBox) {
+	skew := d.skew(b)
+	ctx.moveTo(b.x0+skew, b.y0)
+	ctx.lineTo(b.x1, b.y0)
+	ctx.lineTo(b.x1-skew, b.y1)
+	ctx.lineTo(b.x0, b.y1)
+	ctx.lineTo(b.x0+skew, b.y0)
+}
+
+// ellipseDrawer draws the ellipse inscribed in the box.
+type ellipseDrawer struct{}
+
+func (ellipseDrawer) fill(ctx *Canvas, b shapeBox) { ctx.fill(b.ellipse()) }
+
+func (ellipseDrawer) outline(ctx *Canvas, b shapeBox) {
+	ctx.ellipse(b.cx, b.cy, b.w/2, b.h/2, 0, 2*math.Pi)
+}
+
+// unit returns the unit vector pointing in the (dx, dy) direction.
+func unit(dx, dy float64) (float64, float64) {
+	l := math.Hypot(dx, dy)
+	if l == 0 {
+		return 0, 0
+	}
+	return dx / l, dy / l
+}
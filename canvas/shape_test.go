@@ -0,0 +1,141 @@
+package canvas
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractShapes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "tag alone",
+			src: "+------+\n" +
+				"| {db} |\n" +
+				"+------+",
+			want: []string{"shape db (0,0) (7,2)"},
+		},
+		{
+			name: "tag in front of the label",
+			src: "+-------------+\n" +
+				"| {cloud} web |\n" +
+				"+-------------+",
+			want: []string{"shape cloud (0,0) (14,2)", `text "web" at 10`},
+		},
+		{
+			name: "unknown tag",
+			src: "+-------+\n" +
+				"| {box} |\n" +
+				"+-------+",
+			want: []string{"line", "line", "line", "line", `text "{box}" at 2`},
+		},
+		{
+			name: "tag outside a box",
+			src:  "{db} store",
+			want: []string{`text "{db} store" at 0`},
+		},
+		{
+			name: "line leaving the box",
+			src: "+------+\n" +
+				"| {io} |---+\n" +
+				"+------+   |",
+			want: []string{"shape io (0,0) (7,2)", "line", "line"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scene := (&Diagram{}).ParseASCIIArt(tt.src)
+
+			var got []string
+			for _, fig := range scene.Figures {
+				switch fig := fig.(type) {
+				case *Shape:
+					got = append(got, fmt.Sprintf("shape %s (%d,%d) (%d,%d)", fig.Type, fig.X0, fig.Y0, fig.X1, fig.Y1))
+				case *Line:
+					got = append(got, "line")
+				case *Text:
+					got = append(got, fmt.Sprintf("text %q at %d", fig.Text, fig.X))
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShapeTypes(t *testing.T) {
+	for tag, typ := range shapeTags {
+		if _, ok := shapeDrawers[typ]; !ok {
+			t.Errorf("the %s shape has no drawer", typ)
+		}
+		if _, ok := shapeNames[typ]; !ok {
+			t.Errorf("the %s shape has no name", typ)
+		}
+		if shape := (&Shape{Type: typ}); shape.Tag() != "{"+tag+"}" {
+			t.Errorf("got tag %q for the %s shape", shape.Tag(), typ)
+		}
+	}
+	if len(shapeDrawers) != len(shapeTags) {
+		t.Errorf("got %d drawers for %d shapes", len(shapeDrawers), len(shapeTags))
+	}
+}
+
+func TestUnmarshalShape(t *testing.T) {
+	var scene Scene
+	err := json.Unmarshal([]byte(`{"figures": [{"kind": "shape", "type": "db", "x1": 6, "y1": 2}]}`), &scene)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shape, ok := scene.Figures[0].(*Shape); !ok || shape.Type != Database {
+		t.Errorf("got figure %v, want a database", scene.Figures[0])
+	}
+
+	err = json.Unmarshal([]byte(`{"figures": [{"kind": "shape", "type": "hexagon", "x1": 6, "y1": 2}]}`), &scene)
+	if err == nil || !strings.Contains(err.Error(), `unknown shape type "hexagon"`) {
+		t.Errorf("got error %v for an unknown shape type", err)
+	}
+}
+
+func TestDrawShapes(t *testing.T) {
+	fonts, err := DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for typ := range shapeDrawers {
+		t.Run(string(typ), func(t *testing.T) {
+			scene := &Scene{Figures: []Figure{&Shape{Type: typ, X1: 12, Y1: 6, Color: "#000", Fill: "#f00"}}}
+			img, err := RenderScene(context.Background(), scene, new(bytes.Buffer), Options{Format: PNG, Fonts: fonts})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The outline is drawn in black, and the area is filled in red, except for the actor.
+			var outline bool
+			b := img.Bounds()
+			for y := b.Min.Y; y < b.Max.Y && !outline; y++ {
+				for x := b.Min.X; x < b.Max.X && !outline; x++ {
+					r, g, b, _ := img.At(x, y).RGBA()
+					outline = r < 0x4000 && g < 0x4000 && b < 0x4000
+				}
+			}
+			if !outline {
+				t.Error("the outline is not drawn")
+			}
+			center := color.NRGBAModel.Convert(img.At((b.Min.X+b.Max.X)/2, (b.Min.Y+b.Max.Y)/2+4)).(color.NRGBA)
+			if filled := center.R > 0xc0 && center.G < 0x40; filled != (typ != Actor) {
+				t.Errorf("got the color %v in the center", center)
+			}
+		})
+	}
+}
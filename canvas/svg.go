@@ -0,0 +1,168 @@
+package canvas
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// writeSVG writes the recorded drawing operations as an SVG document. The document size is
+// scaled, while the drawing keeps its coordinates. The texts are converted into glyph outlines,
+// so the output does not depend on the fonts installed on the viewer's machine. The hyperlinks
+// are transparent rectangles placed over the drawing. The title and the description are read
+// by the screen readers.
+func writeSVG(w io.Writer, rec *recorder, width, height int, scale float64, background, title, desc string) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<rect width=\"%d\" height=\"%d\" fill=\"%s\"/>\n", width, height, html.EscapeString(background))
+
+	for _, o := range rec.ops {
+		color := html.EscapeString(o.color)
+		switch o.kind {
+		case strokeOp:
+			var path bytes.Buffer
+			for _, c := range o.curves {
+				fmt.Fprintf(&path, "M%s %sC%s %s %s %s %s %s", num(c.x0), num(c.y0),
+					num(c.x1), num(c.y1), num(c.x2), num(c.y2), num(c.x3), num(c.y3))
+			}
+			fmt.Fprintf(&body, "<path d=\"%s\" stroke=\"%s\" stroke-width=\"%s\"/>\n", path.String(), color, num(o.width))
+		case dotOp:
+			fmt.Fprintf(&body, "<circle cx=\"%s\" cy=\"%s\" r=\"%s\" fill=\"%s\" stroke=\"none\"/>\n", num(o.x), num(o.y), num(o.r), color)
+		case textOp:
+			var path svgPath
+			if glyphOutlines(o, &path); path.Len() > 0 {
+				fmt.Fprintf(&body, "<path d=\"%s\" fill=\"%s\" stroke=\"none\"/>\n", path.String(), color)
+			}
+		case fillOp:
+			var path bytes.Buffer
+			fmt.Fprintf(&path, "M%s %s", num(o.curves[0].x0), num(o.curves[0].y0))
+			for _, c := range o.curves {
+				fmt.Fprintf(&path, "C%s %s %s %s %s %s", num(c.x1), num(c.y1), num(c.x2), num(c.y2), num(c.x3), num(c.y3))
+			}
+			fmt.Fprintf(&body, "<path d=\"%sZ\" fill=\"%s\" stroke=\"none\"/>\n", path.String(), color)
+		}
+	}
+	for _, l := range rec.links {
+		fmt.Fprintf(&body, "<a href=\"%s\"><rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"#fff\" fill-opacity=\"0\" stroke=\"none\"/></a>\n",
+			html.EscapeString(l.url), num(l.x0), num(l.y0), num(l.x1-l.x0), num(l.y1-l.y0))
+	}
+
+	_, err := fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%s\" height=\"%s\" viewBox=\"0 0 %d %d\" role=\"img\">\n"+
+		"<title>%s</title>\n<desc>%s</desc>\n"+
+		"<g fill=\"none\" stroke-linecap=\"round\" stroke-linejoin=\"round\">\n%s</g>\n</svg>\n",
+		num(float64(width)*scale), num(float64(height)*scale), width, height,
+		html.EscapeString(title), html.EscapeString(desc), body.String())
+	if err != nil {
+		return fmt.Errorf("error encoding the SVG image: %w", err)
+	}
+	return nil
+}
+
+// outline receives the contours of the glyphs, made of lines and quadratic curves.
+type outline interface {
+	moveTo(x, y float64)
+	lineTo(x, y float64)
+	quadTo(x1, y1, x, y float64)
+	close()
+}
+
+// svgPath writes the glyph contours as SVG path commands.
+type svgPath struct {
+	bytes.Buffer
+}
+
+func (p *svgPath) moveTo(x, y float64) { fmt.Fprintf(p, "M%s %s", num(x), num(y)) }
+func (p *svgPath) lineTo(x, y float64) { fmt.Fprintf(p, "L%s %s", num(x), num(y)) }
+func (p *svgPath) quadTo(x1, y1, x, y float64) {
+	fmt.Fprintf(p, "Q%s %s %s %s", num(x1), num(y1), num(x), num(y))
+}
+func (p *svgPath) close() { p.WriteString("Z") }
+
+// glyphOutlines writes the contours of the text glyphs into path. The glyphs are placed exactly
+// like the rasterizer does, using the advances and the kerning of the font face.
+func glyphOutlines(o op, path outline) {
+	var (
+		buf  truetype.GlyphBuf
+		prev = rune(-1)
+	)
+	dot := fixed.Point26_6{X: fixed.Int26_6(o.x * 64), Y: fixed.Int26_6(o.y * 64)}
+
+	for _, r := range o.text {
+		if prev >= 0 {
+			dot.X += o.face.Kern(prev, r)
+		}
+		if err := buf.Load(o.font, fixed.Int26_6(o.size*64), o.font.Index(r), font.HintingNone); err == nil {
+			start := 0
+			for _, end := range buf.Ends {
+				writeContour(path, buf.Points[start:end], dot)
+				start = end
+			}
+		}
+		advance, _ := o.face.GlyphAdvance(r)
+		dot.X += advance
+		prev = r
+	}
+}
+
+// writeContour converts a TrueType glyph contour into path commands. The points are measured
+// with the Y axis pointing upwards, and consecutive off-curve points imply an on-curve point between them.
+func writeContour(path outline, ps []truetype.Point, dot fixed.Point26_6) {
+	if len(ps) == 0 {
+		return
+	}
+	pt := func(p truetype.Point) (float64, float64) {
+		return float64(dot.X+p.X) / 64, float64(dot.Y-p.Y) / 64
+	}
+	mid := func(x0, y0, x1, y1 float64) (float64, float64) {
+		return (x0 + x1) / 2, (y0 + y1) / 2
+	}
+
+	sx, sy := pt(ps[0])
+	others := ps[1:]
+	if ps[0].Flags&0x01 == 0 {
+		lx, ly := pt(ps[len(ps)-1])
+		if ps[len(ps)-1].Flags&0x01 != 0 {
+			sx, sy = lx, ly
+			others = ps[:len(ps)-1]
+		} else {
+			sx, sy = mid(sx, sy, lx, ly)
+			others = ps
+		}
+	}
+
+	path.moveTo(sx, sy)
+	qx, qy, on0 := sx, sy, true
+	for _, p := range others {
+		x, y := pt(p)
+		on := p.Flags&0x01 != 0
+		switch {
+		case on && on0:
+			path.lineTo(x, y)
+		case on:
+			path.quadTo(qx, qy, x, y)
+		case !on0:
+			mx, my := mid(qx, qy, x, y)
+			path.quadTo(qx, qy, mx, my)
+		}
+		qx, qy, on0 = x, y, on
+	}
+	if !on0 {
+		path.quadTo(qx, qy, sx, sy)
+	}
+	path.close()
+}
+
+// num formats the coordinate with at most two decimals.
+func num(v float64) string {
+	v = math.Round(v*100) / 100
+	if v == 0 {
+		v = 0 // avoid the negative zero
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
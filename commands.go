@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/esimov/diagram/batch"
+	"github.com/esimov/diagram/canvas"
+)
+
+// command defines a CLI subcommand, invoked as `diagram <name> [options]`.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+// commands holds the supported subcommands.
+var commands = []command{
+	{"parse", "Parse the ASCII art and print the resulting figures", runParse},
+	{"lint", "Check the ASCII arts for problems", runLint},
+	{"fmt", "Format the ASCII arts in their canonical form", runFmt},
+	{"render", "Render multiple diagrams concurrently into a directory", runRender},
+	{"watch", "Re-render the diagrams whenever their source changes", runWatch},
+	{"markdown", "Render the diagram blocks of Markdown files", runMarkdown},
+	{"serve", "Start the HTTP render server", runServe},
+}
+
+// exitCode is returned by the commands which need to terminate with a specific exit status.
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(c))
+}
+
+// findCommand returns the subcommand with the given name.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// printCommands prints the list of the supported subcommands.
+func printCommands(w io.Writer) {
+	fmt.Fprintf(w, "Commands:\n")
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.usage)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun 'diagram <command> -help' for the command options.\n\nOptions:\n")
+}
+
+// commandUsage returns the usage function of a subcommand's flag set.
+func commandUsage(name, args string, fs interface{ PrintDefaults() }) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "Usage: diagram %s [options] %s\n\n", name, args)
+		fs.PrintDefaults()
+	}
+}
+
+// fontFlags holds the font options shared by the commands.
+type fontFlags struct {
+	path *string
+	dir  *string
+}
+
+// addFontFlags defines the -font and -fontdir flags on the flag set.
+func addFontFlags(fs *flag.FlagSet) *fontFlags {
+	return &fontFlags{
+		path: fs.String("font", "", "Path to the font file (defaults to the embedded font)"),
+		dir:  fs.String("fontdir", "", "Directory with additional TTF/OTF fonts used for headings, code and missing glyphs"),
+	}
+}
+
+// loadFonts returns the font set defined by the flags.
+func (f *fontFlags) loadFonts() (*canvas.FontSet, error) {
+	fonts, err := canvas.NewFontSet(*f.path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the font: %w", err)
+	}
+	if *f.dir != "" {
+		err := fonts.LoadDir(*f.dir)
+		// The fonts which cannot be used are reported, while the others are kept.
+		if errors.Is(err, canvas.ErrUnsupportedFont) {
+			fmt.Fprintf(os.Stderr, "skipping fonts: %v\n", err)
+		} else if err != nil {
+			return nil, fmt.Errorf("error loading the fonts: %w", err)
+		}
+	}
+	return fonts, nil
+}
+
+// diagramFlags holds the parser options shared by the commands.
+type diagramFlags struct {
+	mode   *string
+	compat *string
+}
+
+// addDiagramFlags defines the -mode and -compat flags on the flag set.
+func addDiagramFlags(fs *flag.FlagSet) *diagramFlags {
+	return &diagramFlags{
+		mode:   fs.String("mode", "", "Diagram mode: sequence, or empty for the free form diagrams"),
+		compat: fs.String("compat", "", "Compatibility mode understanding the conventions of another tool: ditaa"),
+	}
+}
+
+// diagram returns the parser configured by the flags.
+func (f *diagramFlags) diagram() (*canvas.Diagram, error) {
+	var err error
+	diagram := &canvas.Diagram{}
+	if diagram.Mode, err = canvas.ParseMode(*f.mode); err != nil {
+		return nil, err
+	}
+	if diagram.Compat, err = canvas.ParseCompat(*f.compat); err != nil {
+		return nil, err
+	}
+	return diagram, nil
+}
+
+// renderDigest returns the digest of the rendering options defined by the flags,
+// so the outputs rendered with other options are not considered up to date.
+func renderDigest(diagram *diagramFlags, fonts *fontFlags) string {
+	return batch.Digest(*diagram.mode, *diagram.compat, *fonts.path, *fonts.dir)
+}
+
+// expandInputs resolves the command line inputs into a list of files. The inputs can be
+// files, glob patterns or directories. The directories are walked recursively,
+// collecting the files having one of the given extensions.
+func expandInputs(inputs []string, exts ...string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, input := range inputs {
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", input, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files matching %q", input)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+
+			err = filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() && slices.Contains(exts, strings.ToLower(filepath.Ext(path))) {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,10 @@
+// Package font embeds the default font used for rendering the hand drawn diagrams,
+// so the binary does not depend on the font files being present next to it.
+package font
+
+import _ "embed"
+
+// Default holds the TTF data of the Gloria Hallelujah font.
+//
+//go:embed gloriahallelujah.ttf
+var Default []byte
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/esimov/diagram/canvas"
+	"github.com/esimov/diagram/format"
+)
+
+// runFmt rewrites the ASCII art files in their canonical form.
+// Without any file arguments it formats the standard input. The files which
+// cannot be formatted without changing their meaning are left untouched.
+func runFmt(args []string) error {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "Write the result to the source file instead of the standard output")
+	diff := fs.Bool("d", false, "Display the diffs instead of rewriting the files")
+	list := fs.Bool("l", false, "List the files whose formatting differs")
+	diagramOpts := addDiagramFlags(fs)
+	fs.Usage = commandUsage("fmt", "[<file|glob|dir>...]", fs)
+	fs.Parse(args)
+
+	diagram, err := diagramOpts.diagram()
+	if err != nil {
+		return fmt.Errorf("fmt: %w", err)
+	}
+
+	if fs.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("fmt: error reading the standard input: %w", err)
+		}
+		res, err := format.Source(src, diagram)
+		if err != nil {
+			return fmt.Errorf("fmt: <standard input>: %w", err)
+		}
+		_, err = os.Stdout.Write(res)
+		return err
+	}
+
+	files, err := expandInputs(fs.Args(), ".txt")
+	if err != nil {
+		return fmt.Errorf("fmt: %w", err)
+	}
+
+	var errs []error
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("fmt: %w", err)
+		}
+		res, err := format.Source(src, diagram)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("fmt: %s: %w", file, err))
+			continue
+		}
+		changed := !bytes.Equal(src, res)
+
+		if *list && changed {
+			fmt.Println(file)
+		}
+		if *diff && changed {
+			os.Stdout.Write(format.Diff(file+".orig", file, src, res))
+		}
+		if *write && changed {
+			info, err := os.Stat(file)
+			if err != nil {
+				return fmt.Errorf("fmt: %w", err)
+			}
+			err = canvas.WriteFile(file, func(w io.Writer) error {
+				_, err := w.Write(res)
+				return err
+			})
+			if err == nil {
+				err = os.Chmod(file, info.Mode().Perm())
+			}
+			if err != nil {
+				return fmt.Errorf("fmt: %w", err)
+			}
+		}
+		if !*list && !*diff && !*write {
+			os.Stdout.Write(res)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,135 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext defines the number of unchanged lines shown around the changes.
+const diffContext = 3
+
+// edit is a single line of the diff: ' ' for an unchanged line, '-' for a removed one and '+' for an added one.
+type edit struct {
+	op   byte
+	text string
+}
+
+// Diff returns the differences between the two sources in unified diff format.
+// It returns nil if the sources are identical.
+func Diff(oldName, newName string, a, b []byte) []byte {
+	if bytes.Equal(a, b) {
+		return nil
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+
+	for i := 0; i < len(edits); {
+		// Find the next change and the hunk surrounding it.
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+		start := max(0, i-diffContext)
+		end := i
+		for unchanged := 0; end < len(edits) && unchanged <= 2*diffContext; end++ {
+			if edits[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// Drop the trailing unchanged lines exceeding the context.
+		for end > i && edits[end-1].op == ' ' && trailing(edits[:end]) > diffContext {
+			end--
+		}
+
+		oldLine, newLine := 1, 1
+		for _, e := range edits[:start] {
+			if e.op != '+' {
+				oldLine++
+			}
+			if e.op != '-' {
+				newLine++
+			}
+		}
+		var oldCount, newCount int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+		for _, e := range edits[start:end] {
+			fmt.Fprintf(&buf, "%c%s\n", e.op, e.text)
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
+
+// diffLines computes the line edits transforming a into b, based on their longest common subsequence.
+func diffLines(a, b []string) []edit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
+
+// trailing returns the number of unchanged lines at the end of the edits.
+func trailing(edits []edit) int {
+	n := 0
+	for i := len(edits) - 1; i >= 0 && edits[i].op == ' '; i-- {
+		n++
+	}
+	return n
+}
+
+func splitLines(src []byte) []string {
+	s := strings.TrimSuffix(string(src), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
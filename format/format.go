@@ -0,0 +1,588 @@
+// Package format implements the canonical formatting of the ASCII diagrams.
+//
+// The source is parsed into a scene of figures, which is then emitted back as ASCII art.
+// While doing so the ragged box edges and the arrowheads detached from their lines are
+// snapped into place, the tabs are expanded, the trailing whitespace is removed and the
+// line endings are normalized. Formatting an already formatted source is a no-op.
+//
+// The formatter never changes the meaning of the diagram: the formatted source is parsed
+// again, and it's rejected unless it has the same lines and labels.
+package format
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/esimov/diagram/canvas"
+)
+
+// tabWidth defines the tab stops used when expanding the tabs.
+const tabWidth = 8
+
+// Source formats the ASCII diagram and returns the canonical representation. The diagram
+// is parsed following the conventions of its mode and compatibility mode; a nil diagram
+// stands for a free form one. An error is returned if the formatting would change the
+// lines or the labels of the diagram, which happens only with ambiguous sources.
+func Source(src []byte, diagram *canvas.Diagram) ([]byte, error) {
+	if diagram == nil {
+		diagram = &canvas.Diagram{}
+	}
+	l := newLayout(diagram, expandTabs(strings.ReplaceAll(string(src), "\r\n", "\n")))
+	l.joinCorners()
+	l.joinEdges()
+	l.snapEndings()
+	l.dropCorners()
+
+	out := l.emit()
+	if y, ok := l.check(newLayout(diagram, string(out))); !ok {
+		return nil, fmt.Errorf("line %d: the formatted diagram would not have the same lines and labels", y+1)
+	}
+	return out, nil
+}
+
+// layout holds the figures being formatted.
+type layout struct {
+	diagram *canvas.Diagram
+	src     [][]rune
+	lines   []*canvas.Line
+	texts   []*canvas.Text
+	// dots holds the orientation of the single cell lines, true meaning vertical.
+	dots map[*canvas.Line]bool
+}
+
+// newLayout returns the layout holding the lines and the labels of the source, as they are written.
+// The links, the label markup and the shape tags are kept in the labels.
+func newLayout(diagram *canvas.Diagram, src string) *layout {
+	rows := strings.Split(src, "\n")
+	scene := diagram.ParseOutline(strings.Join(rows, "\n"))
+
+	l := &layout{diagram: diagram, dots: make(map[*canvas.Line]bool)}
+	for _, row := range rows {
+		l.src = append(l.src, []rune(row))
+	}
+	for _, fig := range scene.Figures {
+		switch fig := fig.(type) {
+		case *canvas.Line:
+			line := rawLine(fig)
+			// Single cell lines keep their original orientation.
+			if line.X0 == line.X1 && line.Y0 == line.Y1 {
+				c := l.at(line.X0, line.Y0)
+				l.dots[line] = c == '|' || c == '!' || c == ':'
+			}
+			l.lines = append(l.lines, line)
+		case *canvas.Text:
+			l.texts = append(l.texts, fig)
+		}
+	}
+	return l
+}
+
+// rawLine returns a copy of the line having the original coordinates, including the arrowheads.
+// The parser moves the arrow endings by one cell, so they touch their target.
+func rawLine(line *canvas.Line) *canvas.Line {
+	raw := *line
+	dx, dy := sign(line.X1-line.X0), sign(line.Y1-line.Y0)
+	if raw.Start == canvas.Arrow {
+		raw.X0 += dx
+		raw.Y0 += dy
+	}
+	if raw.End == canvas.Arrow {
+		raw.X1 -= dx
+		raw.Y1 -= dy
+	}
+	return &raw
+}
+
+// direction returns the unit vector of the line's growth.
+func (l *layout) direction(line *canvas.Line) image.Point {
+	dx, dy := sign(line.X1-line.X0), sign(line.Y1-line.Y0)
+	if dx == 0 && dy == 0 {
+		if l.dots[line] {
+			return image.Pt(0, 1)
+		}
+		return image.Pt(1, 0)
+	}
+	return image.Pt(dx, dy)
+}
+
+func (l *layout) isHorizontal(line *canvas.Line) bool {
+	return l.direction(line).Y == 0
+}
+
+func (l *layout) isVertical(line *canvas.Line) bool {
+	return !l.isHorizontal(line)
+}
+
+// end describes one of the ends of a line.
+type end struct {
+	line  *canvas.Line
+	start bool
+	// outward is the unit vector pointing away from the line at this end.
+	outward image.Point
+}
+
+func (e end) point() image.Point {
+	if e.start {
+		return image.Pt(e.line.X0, e.line.Y0)
+	}
+	return image.Pt(e.line.X1, e.line.Y1)
+}
+
+// moveTo moves the line end to the given point.
+func (e end) moveTo(p image.Point) {
+	if e.start {
+		e.line.X0, e.line.Y0 = p.X, p.Y
+	} else {
+		e.line.X1, e.line.Y1 = p.X, p.Y
+	}
+}
+
+// setEnding sets the decoration of the line end.
+func (e end) setEnding(ending canvas.Ending) {
+	if e.start {
+		e.line.Start = ending
+	} else {
+		e.line.End = ending
+	}
+}
+
+// freeEnds returns the undecorated ends of the lines accepted by the filter.
+func (l *layout) freeEnds(filter func(*canvas.Line) bool) []end {
+	var ends []end
+	for _, line := range l.lines {
+		if !filter(line) {
+			continue
+		}
+		dir := l.direction(line)
+		if line.Start == canvas.NoEnding {
+			ends = append(ends, end{line, true, image.Pt(-dir.X, -dir.Y)})
+		}
+		if line.End == canvas.NoEnding {
+			ends = append(ends, end{line, false, dir})
+		}
+	}
+	return ends
+}
+
+// isFree reports whether the cell is not covered by a label.
+func (l *layout) isFree(p image.Point) bool {
+	for _, text := range l.texts {
+		if p.In(l.textBounds(text)) {
+			return false
+		}
+	}
+	return true
+}
+
+// joinCorners fixes the ragged box corners: the perpendicular lines having their
+// ends diagonally adjacent are both extended to meet in a common corner.
+func (l *layout) joinCorners() {
+	for _, v := range l.freeEnds(l.isVertical) {
+		for _, h := range l.freeEnds(l.isHorizontal) {
+			pv, ph := v.point(), h.point()
+			if abs(pv.X-ph.X) != 1 || abs(pv.Y-ph.Y) != 1 {
+				continue
+			}
+			corner := image.Pt(pv.X, ph.Y)
+			// The lines can only be extended, not shortened.
+			if corner.Sub(pv) != v.outward || corner.Sub(ph) != h.outward || !l.isFree(corner) {
+				continue
+			}
+			v.moveTo(corner)
+			h.moveTo(corner)
+		}
+	}
+}
+
+// joinEdges extends the lines which stop one cell before a perpendicular line,
+// so they join the perpendicular line instead of leaving a gap.
+func (l *layout) joinEdges() {
+	for _, e := range l.freeEnds(func(*canvas.Line) bool { return true }) {
+		next := e.point().Add(e.outward)
+		for _, other := range l.lines {
+			if other == e.line || l.isHorizontal(other) == l.isHorizontal(e.line) {
+				continue
+			}
+			if next.In(other.Bounds()) && l.isFree(next) {
+				e.moveTo(next)
+				break
+			}
+		}
+	}
+}
+
+// endingDirections maps the ASCII line endings to the direction they are pointing to.
+// The circle ending can be attached to the lines of any direction.
+var endingDirections = map[string][]image.Point{
+	">": {image.Pt(1, 0)},
+	"<": {image.Pt(-1, 0)},
+	"v": {image.Pt(0, 1)},
+	"^": {image.Pt(0, -1)},
+	"*": {image.Pt(1, 0), image.Pt(-1, 0), image.Pt(0, 1), image.Pt(0, -1)},
+}
+
+// snapEndings attaches the standalone arrowheads and circles to the line end they belong to,
+// when they are separated by a space or they are off by one row or column.
+func (l *layout) snapEndings() {
+	var texts []*canvas.Text
+	for _, text := range l.texts {
+		if !l.snapEnding(text) {
+			texts = append(texts, text)
+		}
+	}
+	l.texts = texts
+}
+
+// snapEnding attaches the ending symbol represented by the text to a nearby line.
+func (l *layout) snapEnding(text *canvas.Text) bool {
+	dirs, ok := endingDirections[text.Text]
+	if !ok || text.Style != canvas.BodyFont {
+		return false
+	}
+	p := image.Pt(text.X, text.Y)
+
+	for _, e := range l.freeEnds(func(*canvas.Line) bool { return true }) {
+		out := e.outward
+		for _, dir := range dirs {
+			if out != dir {
+				continue
+			}
+			// The symbol is separated by a space from the line end.
+			if e.point().Add(out.Mul(2)) == p && l.isFree(e.point().Add(out)) {
+				e.moveTo(p)
+				e.setEnding(endingOf(text.Text))
+				return true
+			}
+			// The symbol is placed right after the line end, but one row or column aside.
+			side := image.Pt(out.Y, out.X)
+			next := e.point().Add(out)
+			if next.Add(side) == p || next.Sub(side) == p {
+				if l.isFree(next) {
+					e.moveTo(next)
+					e.setEnding(endingOf(text.Text))
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// dropCorners removes the stray "+" symbols placed right next to a line end,
+// which are usually the remains of a ragged box corner.
+func (l *layout) dropCorners() {
+	var ends []image.Point
+	for _, line := range l.lines {
+		ends = append(ends, image.Pt(line.X0, line.Y0), image.Pt(line.X1, line.Y1))
+	}
+
+	var texts []*canvas.Text
+	for _, text := range l.texts {
+		if text.Text == "+" && isNextTo(image.Pt(text.X, text.Y), ends) {
+			continue
+		}
+		texts = append(texts, text)
+	}
+	l.texts = texts
+}
+
+// cell describes a cell of the ASCII grid covered by lines.
+type cell struct {
+	horizontal, vertical, muted, dashed bool
+	ending                              byte
+}
+
+// cells returns the cells covered by the lines, and the size of the area they cover.
+func (l *layout) cells() (map[image.Point]*cell, image.Point) {
+	cells := make(map[image.Point]*cell)
+	get := func(p image.Point) *cell {
+		c, ok := cells[p]
+		if !ok {
+			c = new(cell)
+			cells[p] = c
+		}
+		return c
+	}
+
+	var size image.Point
+	grow := func(r image.Rectangle) {
+		size.X = max(size.X, r.Max.X)
+		size.Y = max(size.Y, r.Max.Y)
+	}
+
+	for _, line := range l.lines {
+		grow(line.Bounds())
+
+		dir := l.direction(line)
+		dx, dy := dir.X, dir.Y
+		horizontal := dy == 0
+
+		for x, y := line.X0, line.Y0; ; x, y = x+dx, y+dy {
+			c := get(image.Pt(x, y))
+			switch {
+			case x == line.X0 && y == line.Y0 && line.Start != canvas.NoEnding:
+				c.ending = endingSymbol(line.Start, -dx, -dy)
+			case x == line.X1 && y == line.Y1 && line.End != canvas.NoEnding:
+				c.ending = endingSymbol(line.End, dx, dy)
+			case horizontal:
+				c.horizontal = true
+			default:
+				c.vertical = true
+			}
+			if line.Color == "#666" {
+				c.muted = true
+			}
+			if line.Dashed {
+				c.dashed = true
+			}
+			if x == line.X1 && y == line.Y1 {
+				break
+			}
+		}
+	}
+	return cells, size
+}
+
+// emit writes the figures back as ASCII art.
+func (l *layout) emit() []byte {
+	cells, size := l.cells()
+	grow := func(r image.Rectangle) {
+		size.X = max(size.X, r.Max.X)
+		size.Y = max(size.Y, r.Max.Y)
+	}
+
+	// The "+", "~" and "!" characters of the labels are escaped when a line would be extended
+	// through them: they are placed after or before a horizontal line, or above or below a vertical one.
+	isLine := func(p image.Point, horizontal bool) bool {
+		c, ok := cells[p]
+		return ok && c.ending == 0 && (horizontal && c.horizontal || !horizontal && c.vertical)
+	}
+	touchesLine := func(p image.Point) bool {
+		return isLine(p.Add(image.Pt(-1, 0)), true) || isLine(p.Add(image.Pt(1, 0)), true) ||
+			isLine(p.Add(image.Pt(0, -1)), false) || isLine(p.Add(image.Pt(0, 1)), false)
+	}
+	type label struct {
+		text []rune
+		x, y int
+	}
+	labels := make([]label, len(l.texts))
+	for i, text := range l.texts {
+		s, x := l.markup(text, touchesLine)
+		labels[i] = label{[]rune(s), max(x, 0), text.Y}
+		grow(image.Rect(labels[i].x, text.Y, labels[i].x+len(labels[i].text), text.Y+1))
+	}
+	slices.SortStableFunc(labels, func(a, b label) int {
+		return cmp.Or(cmp.Compare(a.y, b.y), cmp.Compare(a.x, b.x))
+	})
+
+	grid := make([][]rune, size.Y)
+	for y := range grid {
+		grid[y] = []rune(strings.Repeat(" ", size.X))
+	}
+	for p, c := range cells {
+		switch {
+		case c.ending != 0:
+			grid[p.Y][p.X] = rune(c.ending)
+		case c.horizontal && c.vertical:
+			grid[p.Y][p.X] = '+'
+			// The ditaa rounded corners are kept.
+			if r := l.at(p.X, p.Y); l.diagram.Compat == canvas.Ditaa && (r == '/' || r == '\\') {
+				grid[p.Y][p.X] = r
+			}
+		case c.horizontal && c.dashed:
+			grid[p.Y][p.X] = '='
+		case c.horizontal && c.muted:
+			grid[p.Y][p.X] = '~'
+		case c.horizontal:
+			grid[p.Y][p.X] = '-'
+		case c.dashed:
+			grid[p.Y][p.X] = ':'
+		case c.muted:
+			grid[p.Y][p.X] = '!'
+		default:
+			grid[p.Y][p.X] = '|'
+		}
+	}
+	// The labels never overwrite the lines, nor run into the following label of the row.
+	for i, label := range labels {
+		row := grid[label.y]
+		end := len(row)
+		if i+1 < len(labels) && labels[i+1].y == label.y {
+			end = labels[i+1].x - 1
+		}
+		for j, c := range label.text {
+			x := label.x + j
+			if x >= end || row[x] != ' ' {
+				break
+			}
+			row[x] = c
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, row := range grid {
+		buf.WriteString(strings.TrimRight(string(row), " "))
+		buf.WriteByte('\n')
+	}
+	out := bytes.TrimRight(buf.Bytes(), "\n")
+	if len(out) == 0 {
+		return nil
+	}
+	return append(out, '\n')
+}
+
+// at returns the character of the original source at (x, y).
+func (l *layout) at(x, y int) rune {
+	if 0 <= y && y < len(l.src) && 0 <= x && x < len(l.src[y]) {
+		return l.src[y][x]
+	}
+	return ' '
+}
+
+// markup returns the label text as it's written, and the column where it starts. The characters
+// which would be parsed as lines are escaped; an escaped first character moves the start one column
+// left. The muted labels are wrapped in backslashes. touchesLine reports whether a line is next
+// to a cell, and it can be nil.
+func (l *layout) markup(text *canvas.Text, touchesLine func(image.Point) bool) (string, int) {
+	var touches func(int) bool
+	if touchesLine != nil {
+		touches = func(col int) bool { return touchesLine(image.Pt(text.X+col, text.Y)) }
+	}
+	s, x := canvas.EscapeText(text.Text, l.diagram.Mode, touches), text.X
+	if strings.HasPrefix(text.Text, "\\") && strings.HasPrefix(s, "\\\\") ||
+		!strings.HasPrefix(text.Text, "\\") && strings.HasPrefix(s, "\\") {
+		x--
+	}
+	if text.Color == "#666" && strings.HasPrefix(s, "\\") {
+		s += "\\"
+	}
+	return s, x
+}
+
+// check reports whether the formatted layout has the same lines and labels as l.
+// Otherwise it returns the first row where they differ.
+func (l *layout) check(formatted *layout) (int, bool) {
+	y, ok := -1, true
+	mismatch := func(row int) {
+		if ok || row < y {
+			y = row
+		}
+		ok = false
+	}
+
+	want, _ := l.cells()
+	got, _ := formatted.cells()
+	for p, c := range want {
+		if d, found := got[p]; !found || *c != *d {
+			mismatch(p.Y)
+		}
+	}
+	for p := range got {
+		if _, found := want[p]; !found {
+			mismatch(p.Y)
+		}
+	}
+
+	key := func(text *canvas.Text) string {
+		return fmt.Sprintf("%d:%d:%s:%s", text.Y, text.X, text.Color, text.Text)
+	}
+	texts := make(map[string]int)
+	for _, text := range l.texts {
+		texts[key(text)]++
+	}
+	for _, text := range formatted.texts {
+		if texts[key(text)]--; texts[key(text)] < 0 {
+			mismatch(text.Y)
+		}
+	}
+	for _, text := range l.texts {
+		if texts[key(text)] > 0 {
+			mismatch(text.Y)
+		}
+	}
+	return y, ok
+}
+
+// endingOf returns the line ending represented by the ASCII symbol.
+func endingOf(symbol string) canvas.Ending {
+	if symbol == "*" {
+		return canvas.Circle
+	}
+	return canvas.Arrow
+}
+
+// endingSymbol returns the ASCII symbol of a line ending pointing to the (dx, dy) direction.
+func endingSymbol(ending canvas.Ending, dx, dy int) byte {
+	if ending == canvas.Circle {
+		return '*'
+	}
+	switch {
+	case dx > 0:
+		return '>'
+	case dx < 0:
+		return '<'
+	case dy > 0:
+		return 'v'
+	}
+	return '^'
+}
+
+func (l *layout) textBounds(text *canvas.Text) image.Rectangle {
+	s, x := l.markup(text, nil)
+	return image.Rect(x, text.Y, x+utf8.RuneCountInString(s), text.Y+1)
+}
+
+func isNextTo(p image.Point, points []image.Point) bool {
+	for _, q := range points {
+		if abs(p.X-q.X) <= 1 && abs(p.Y-q.Y) <= 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTabs replaces the tabs with spaces, up to the next tab stop.
+func expandTabs(s string) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+	var sb strings.Builder
+	col := 0
+	for _, r := range s {
+		switch r {
+		case '\t':
+			n := tabWidth - col%tabWidth
+			sb.WriteString(strings.Repeat(" ", n))
+			col += n
+		case '\n':
+			sb.WriteRune(r)
+			col = 0
+		default:
+			sb.WriteRune(r)
+			col++
+		}
+	}
+	return sb.String()
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,112 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/esimov/diagram/canvas"
+)
+
+func TestSourceIdempotent(t *testing.T) {
+	tests := []struct {
+		name    string
+		diagram *canvas.Diagram
+		src     string
+		want    string
+	}{
+		{
+			name: "muted characters in free text",
+			src:  "~~~~~~>  !\n",
+			want: "~~~~~~>  !\n",
+		},
+		{
+			name: "plus signs inside a box",
+			src: "+-------+\n" +
+				"| a+b+c |\n" +
+				"+-------+\n",
+			want: "+-------+\n" +
+				"| a+b+c |\n" +
+				"+-------+\n",
+		},
+		{
+			name: "exclamation marks before a label",
+			src:  "x! y!  z\n",
+			want: "x! y!  z\n",
+		},
+		{
+			name: "pipe between letters inside a box",
+			src: "+--------+\n" +
+				"| a\\|b   |\n" +
+				"+--------+\n",
+			want: "+--------+\n" +
+				"| a|b    |\n" +
+				"+--------+\n",
+		},
+		{
+			name: "plus sign below a line",
+			src: " |\n" +
+				"\\+x\n",
+			want: " |\n" +
+				"\\+x\n",
+		},
+		{
+			name: "pipe between letters",
+			src:  "a|b\n",
+			want: "a|b\n",
+		},
+		{
+			name: "hyphens starting a word",
+			src:  "run --verbose\n",
+			want: "run --verbose\n",
+		},
+		{
+			name: "label markup",
+			src:  "# Title  `mono`  [docs](https://example.com)\n",
+			want: "# Title  `mono`  [docs](https://example.com)\n",
+		},
+		{
+			name:    "ditaa dashed box with rounded corners",
+			diagram: &canvas.Diagram{Compat: canvas.Ditaa},
+			src: "/--=--\\\n" +
+				": cF00 |\n" +
+				"\\-----/\n",
+			want: "/=====\\\n" +
+				": cF00 |\n" +
+				"\\-----/\n",
+		},
+		{
+			name:    "sequence reply",
+			diagram: &canvas.Diagram{Mode: canvas.SequenceMode},
+			src: "|  a\\~b  |\n" +
+				"|<~~~~~~~+\n",
+			want: "|  a\\~b  |\n" +
+				"|<~~~~~~~+\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Source([]byte(tt.src), tt.diagram)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("Source(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+			again, err := Source(got, tt.diagram)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(again) != string(got) {
+				t.Errorf("Source(%q) = %q, not idempotent", got, again)
+			}
+		})
+	}
+}
+
+func TestSourceChangingMeaning(t *testing.T) {
+	for _, src := range []string{"|-|\n", `!*=-|"+:-b>-|` + "\n"} {
+		if got, err := Source([]byte(src), nil); err == nil {
+			t.Errorf("Source(%q) = %q, want an error", src, got)
+		}
+	}
+}
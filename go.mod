@@ -5,18 +5,18 @@ go 1.22
 require (
 	gioui.org v0.8.0
 	github.com/fogleman/gg v1.0.1-0.20180308184255-c97f757e6f0e
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/jroimartin/gocui v0.5.0
+	golang.org/x/image v0.18.0
 )
 
 require (
 	gioui.org/shader v1.0.8 // indirect
 	github.com/go-text/typesetting v0.2.1 // indirect
-	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/mattn/go-runewidth v0.0.9 // indirect
 	github.com/nsf/termbox-go v1.1.1 // indirect
 	golang.org/x/exp v0.0.0-20240707233637-46b078467d37 // indirect
 	golang.org/x/exp/shiny v0.0.0-20240707233637-46b078467d37 // indirect
-	golang.org/x/image v0.18.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
 	golang.org/x/text v0.16.0 // indirect
 )
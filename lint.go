@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/esimov/diagram/io"
+	"github.com/esimov/diagram/lint"
+)
+
+// Exit codes of the lint command.
+const (
+	lintProblems exitCode = 1
+	lintFailure  exitCode = 2
+)
+
+// runLint checks the ASCII art files for problems. It terminates with a non-zero exit code
+// when errors (or warnings in strict mode) are found, or when the files cannot be read.
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	format := fs.String("format", "text", "Output format: text or json")
+	strict := fs.Bool("strict", false, "Treat the warnings as errors")
+	diagramOpts := addDiagramFlags(fs)
+	fs.Usage = commandUsage("lint", "<file|glob|dir>...", fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return lintFailure
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "lint: unsupported output format %q\n", *format)
+		return lintFailure
+	}
+	diagram, err := diagramOpts.diagram()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+		return lintFailure
+	}
+
+	files, err := expandInputs(fs.Args(), ".txt")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+		return lintFailure
+	}
+
+	problems := []lint.Problem{}
+	for _, file := range files {
+		content, err := io.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "lint: %v\n", err)
+			return lintFailure
+		}
+		problems = append(problems, lint.Check(file, content, diagram)...)
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(problems); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+	}
+
+	for _, p := range problems {
+		if p.Severity == lint.Error || *strict {
+			return lintProblems
+		}
+	}
+	return nil
+}
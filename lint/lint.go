@@ -0,0 +1,209 @@
+// Package lint checks the ASCII diagrams for constructs which are not rendered as intended.
+// Besides the parser diagnostics it reports the characters the parser cannot handle
+// and the lines which do not connect to anything.
+package lint
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/esimov/diagram/canvas"
+)
+
+// Severity defines how serious a problem is.
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// The problems reported by the linter, besides the parser diagnostics.
+const (
+	Tab              canvas.DiagnosticCode = "tab"
+	NonASCII         canvas.DiagnosticCode = "non-ascii"
+	UnterminatedLine canvas.DiagnosticCode = "unterminated-line"
+)
+
+// severities maps the problem codes to their severity. The codes missing from the map are warnings.
+var severities = map[canvas.DiagnosticCode]Severity{
+	Tab:                   Error,
+	NonASCII:              Error,
+	canvas.DanglingEnding: Error,
+	canvas.OrphanCorner:   Error,
+	canvas.MisalignedEdge: Error,
+}
+
+// Problem is an issue found in a diagram source file.
+type Problem struct {
+	File     string                `json:"file"`
+	Pos      canvas.Position       `json:"pos"`
+	Severity Severity              `json:"severity"`
+	Code     canvas.DiagnosticCode `json:"code"`
+	Message  string                `json:"message"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%s: %s: %s (%s)", p.File, p.Pos, p.Severity, p.Message, p.Code)
+}
+
+// Check lints the diagram source parsed by the diagram, or as a free-form diagram if it's nil,
+// and returns the problems ordered by their position.
+func Check(file, src string, diagram *canvas.Diagram) []Problem {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+
+	var problems []Problem
+	add := func(diag canvas.Diagnostic) {
+		severity, ok := severities[diag.Code]
+		if !ok {
+			severity = Warning
+		}
+		problems = append(problems, Problem{
+			File:     file,
+			Pos:      diag.Pos,
+			Severity: severity,
+			Code:     diag.Code,
+			Message:  diag.Message,
+		})
+	}
+
+	// The columns are counted in runes, like the parser does.
+	var lines [][]rune
+	for _, line := range strings.Split(src, "\n") {
+		lines = append(lines, []rune(line))
+	}
+	for y, line := range lines {
+		for x, r := range line {
+			pos := canvas.Position{Line: y + 1, Column: x + 1}
+			switch {
+			case r == '\t':
+				add(canvas.Diagnostic{Pos: pos, Code: Tab, Message: "tab character breaks the alignment, use spaces instead"})
+			case r >= utf8.RuneSelf:
+				add(canvas.Diagnostic{Pos: pos, Code: NonASCII, Message: fmt.Sprintf("non-ASCII character %q (%U) is not supported", r, r)})
+			}
+		}
+	}
+
+	if diagram == nil {
+		diagram = &canvas.Diagram{}
+	}
+	scene, diags := diagram.Parse(src)
+	for _, diag := range diags {
+		add(diag)
+	}
+	for _, diag := range checkLineEnds(lines, scene) {
+		add(diag)
+	}
+
+	sortProblems(problems)
+	return problems
+}
+
+// checkLineEnds reports the lines having an undecorated end which leads nowhere. An end is considered
+// connected if it touches another line or if there is any character right after it, one cell further
+// (like a label separated by a space) or diagonally after it (like a misaligned corner).
+func checkLineEnds(lines [][]rune, scene *canvas.Scene) []canvas.Diagnostic {
+	var diags []canvas.Diagnostic
+
+	isBlank := func(x, y int) bool {
+		if y < 0 || y >= len(lines) || x < 0 || x >= len(lines[y]) {
+			return true
+		}
+		return lines[y][x] == ' '
+	}
+
+	// The grid holds the number of lines covering each cell of the scene.
+	area := scene.Bounds()
+	grid := make([][]int, area.Dy())
+	for y := range grid {
+		grid[y] = make([]int, area.Dx())
+	}
+	for _, fig := range scene.Figures {
+		if line, ok := fig.(*canvas.Line); ok {
+			b := line.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					grid[y-area.Min.Y][x-area.Min.X]++
+				}
+			}
+		}
+	}
+	touchesLine := func(self *canvas.Line, x, y int) bool {
+		p := image.Pt(x, y)
+		if !p.In(area) {
+			return false
+		}
+		covering := grid[y-area.Min.Y][x-area.Min.X]
+		if p.In(self.Bounds()) {
+			covering--
+		}
+		return covering > 0
+	}
+
+	for _, fig := range scene.Figures {
+		line, ok := fig.(*canvas.Line)
+		if !ok {
+			continue
+		}
+		dx, dy := sign(line.X1-line.X0), sign(line.Y1-line.Y0)
+		if dx == 0 && dy == 0 {
+			continue
+		}
+
+		ends := []struct {
+			ending canvas.Ending
+			x, y   int
+			dx, dy int
+		}{
+			{line.Start, line.X0, line.Y0, -dx, -dy},
+			{line.End, line.X1, line.Y1, dx, dy},
+		}
+	nextEnd:
+		for _, end := range ends {
+			if end.ending != canvas.NoEnding || touchesLine(line, end.x, end.y) {
+				continue
+			}
+			// The cells after the line end, including the diagonal ones.
+			neighbours := [][2]int{
+				{end.x + end.dx, end.y + end.dy},
+				{end.x + 2*end.dx, end.y + 2*end.dy},
+				{end.x + end.dx + end.dy, end.y + end.dy + end.dx},
+				{end.x + end.dx - end.dy, end.y + end.dy - end.dx},
+			}
+			for _, n := range neighbours {
+				if !isBlank(n[0], n[1]) || touchesLine(line, n[0], n[1]) {
+					continue nextEnd
+				}
+			}
+			diags = append(diags, canvas.Diagnostic{
+				Pos:     canvas.Position{Line: end.y + 1, Column: end.x + 1},
+				Code:    UnterminatedLine,
+				Message: "line does not lead to any other figure",
+			})
+		}
+	}
+	return diags
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+// sortProblems orders the problems by their position in the source file.
+func sortProblems(problems []Problem) {
+	slices.SortStableFunc(problems, func(a, b Problem) int {
+		if a.Pos.Line != b.Pos.Line {
+			return a.Pos.Line - b.Pos.Line
+		}
+		return a.Pos.Column - b.Pos.Column
+	})
+}
@@ -0,0 +1,81 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/esimov/diagram/canvas"
+)
+
+func TestCheckBoxes(t *testing.T) {
+	srcs := []string{
+		"+-----+\n" +
+			"| API |--->  x\n" +
+			"+-----+\n",
+		"+---+     +---+\n" +
+			"| a |---->| b |\n" +
+			"+---+     +---+\n",
+	}
+	for _, src := range srcs {
+		for _, p := range Check("test.txt", src, nil) {
+			if p.Severity == Error {
+				t.Errorf("unexpected error %v in\n%s", p, src)
+			}
+		}
+	}
+}
+
+func TestCheckRuneColumns(t *testing.T) {
+	src := "é ñ ü ---\n"
+
+	var got []canvas.Position
+	for _, p := range Check("test.txt", src, nil) {
+		if p.Code == UnterminatedLine {
+			got = append(got, p.Pos)
+		}
+	}
+	want := []canvas.Position{{Line: 1, Column: 9}}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("unterminated lines at %v, want %v", got, want)
+	}
+
+	problems := Check("test.txt", "ab\té\n", nil)
+	if len(problems) != 2 {
+		t.Fatalf("got %d problems, want 2: %v", len(problems), problems)
+	}
+	if pos := problems[0].Pos; problems[0].Code != Tab || pos.Column != 3 {
+		t.Errorf("tab reported at %v (%s), want column 3", pos, problems[0].Code)
+	}
+	if pos := problems[1].Pos; problems[1].Code != NonASCII || pos.Column != 4 {
+		t.Errorf("non-ASCII character reported at %v (%s), want column 4", pos, problems[1].Code)
+	}
+}
+
+func TestCheckDiagram(t *testing.T) {
+	// The rounded corners are only understood in the ditaa compatibility mode.
+	src := "/---\\\n" +
+		"| a |\n" +
+		"\\---/\n"
+	if problems := Check("test.txt", src, nil); len(problems) == 0 {
+		t.Error("no problems reported for the free-form diagram")
+	}
+	if problems := Check("test.txt", src, &canvas.Diagram{Compat: canvas.Ditaa}); len(problems) != 0 {
+		t.Errorf("got problems %v in the ditaa diagram", problems)
+	}
+}
+
+func BenchmarkCheck(b *testing.B) {
+	// A grid of boxes connected by lines leading nowhere.
+	var sb strings.Builder
+	for row := 0; row < 50; row++ {
+		for _, line := range []string{"+---+    ", "| a |--- ", "+---+    "} {
+			sb.WriteString(strings.Repeat(line, 20) + "\n")
+		}
+	}
+	src := sb.String()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Check("bench.txt", src, nil)
+	}
+}
@@ -4,13 +4,21 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	_ "embed"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"image"
+	goio "io"
 	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"gioui.org/app"
@@ -33,16 +41,22 @@ CLI app to convert ASCII arts into hand drawn diagrams.
 // Version indicates the current build version.
 var version string
 
-var defaultFontFile = "font/gloriahallelujah.ttf"
-
 //go:embed sample.txt
 var defaultContent string
 
 var (
-	source      = flag.String("in", "", "Source")
-	destination = flag.String("out", "", "Destination")
-	fontPath    = flag.String("font", defaultFontFile, "Path to the font file")
-	preview     = flag.Bool("preview", true, "Show the preview window")
+	source         = flag.String("in", "", "Source (ASCII art or JSON scene with .json extension), or - for the standard input")
+	inFormat       = flag.String("in-format", "", "Source format: ascii or json (defaults to the source extension, or for the standard input to json if it starts with {)")
+	destination    = flag.String("out", "", "Destination, or - for the standard output")
+	outFormat      = flag.String("format", "", "Output format: png, png8, jpeg, gif, svg, pdf or dot (defaults to the destination extension)")
+	quality        = flag.Int("quality", canvas.DefaultQuality, "Quality of the JPEG images (1-100)")
+	diagramOpts    = addDiagramFlags(flag.CommandLine)
+	altText        = flag.String("alt", "", "Write the text description of the diagram (its alternative text) to the file, or - for the standard output")
+	animate        = flag.Bool("animate", false, "Write an animated GIF or PNG, replaying the drawing of the diagram")
+	frameRate      = flag.Float64("fps", canvas.DefaultFrameRate, "Frame rate of the animation")
+	strokeDuration = flag.Duration("stroke", canvas.DefaultStrokeDuration, "Drawing duration of a single stroke in the animation")
+	fontOpts       = addFontFlags(flag.CommandLine)
+	preview        = flag.Bool("preview", true, "Show the preview window")
 )
 
 func main() {
@@ -50,38 +64,173 @@ func main() {
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, fmt.Sprintf(HelpBanner, version))
+		printCommands(os.Stderr)
 		flag.PrintDefaults()
 	}
+
+	if len(os.Args) > 1 {
+		if cmd, ok := findCommand(os.Args[1]); ok {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				var code exitCode
+				if errors.As(err, &code) {
+					os.Exit(int(code))
+				}
+				log.Fatal(err)
+			}
+			return
+		}
+	}
 	flag.Parse()
 
+	fonts, err := fontOpts.loadFonts()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// In case the option parameters are used, the hand-drawn diagrams are generated without to enter into the CLI app.
 	if (*source != "") && (*destination != "") {
-		content, err := io.ReadFile(*source)
+		diagram, err := diagramOpts.diagram()
+		if err != nil {
+			log.Fatal(err)
+		}
+		scene, diags, err := readScene(*source, *inFormat, diagram)
 		if err != nil {
 			log.Fatalf("error reading source file: %v", err)
 		}
+		printDiagnostics(*source, diags)
 
-		err = canvas.DrawDiagram(content, *destination, *fontPath)
-		if err != nil {
-			log.Fatal("Error on converting the ascii art to hand drawn diagrams!")
-		} else if *preview {
-			f, err := os.Open(*destination)
+		// The description is computed once, for the alternative text and for the image.
+		var description string
+		if *altText != "" {
+			if *altText == "-" && *destination == "-" {
+				log.Fatal("the image and its description cannot be both written to the standard output")
+			}
+			description = canvas.Describe(scene)
+			err = writeOutput(*altText, func(w goio.Writer) error {
+				_, err := fmt.Fprintln(w, description)
+				return err
+			})
+			if err != nil {
+				log.Fatalf("error writing the diagram description: %v", err)
+			}
+		}
+
+		// The graph of the connections between the boxes is written instead of an image.
+		ext := strings.ToLower(filepath.Ext(*destination))
+		if strings.EqualFold(*outFormat, "dot") || *outFormat == "" && (ext == ".dot" || ext == ".gv") {
+			err = writeOutput(*destination, func(w goio.Writer) error {
+				return canvas.WriteDOT(w, scene)
+			})
 			if err != nil {
-				log.Fatalf("Failed to open image '%s': %v\n", *destination, err)
+				log.Fatalf("error writing the diagram graph: %v", err)
+			}
+			return
+		}
+
+		imgFormat := canvas.FormatOf(*destination)
+		if *outFormat != "" {
+			if imgFormat, err = canvas.ParseFormat(*outFormat); err != nil {
+				log.Fatal(err)
 			}
+		}
+
+		opts := canvas.Options{Format: imgFormat, Fonts: fonts, Quality: *quality, Description: description}
 
-			source, _, err := image.Decode(f)
+		if *animate {
+			anim := canvas.Animation{FrameRate: *frameRate, StrokeDuration: *strokeDuration}
+			err = writeOutput(*destination, func(w goio.Writer) error {
+				return canvas.RenderAnimation(context.Background(), scene, w, opts, anim)
+			})
 			if err != nil {
-				log.Fatalf("Failed to read image '%s': %v\n", *destination, err)
+				log.Fatalf("Error on animating the hand drawn diagram: %v", err)
 			}
+			return
+		}
 
+		var img image.Image
+		err = writeOutput(*destination, func(w goio.Writer) error {
+			img, err = canvas.RenderScene(context.Background(), scene, w, opts)
+			return err
+		})
+		if err != nil {
+			log.Fatalf("Error on converting the ascii art to hand drawn diagrams: %v", err)
+		}
+		// The preview is not shown when the diagram is written into a pipeline.
+		if *preview && *destination != "-" {
 			gui := gui.NewGUI()
-			if err := gui.Draw(source); err != nil {
+			if err := gui.Draw(img); err != nil {
 				log.Fatalf("diagram GUI draw error: %v", err)
 			}
 		}
 	} else {
-		go ui.InitApp(*fontPath, defaultContent)
+		go ui.InitApp(fonts, defaultContent)
 		app.Main()
 	}
 }
+
+// readScene reads the diagram scene from the source file. The source format is either "ascii"
+// or "json". If it's empty, the files with the .json extension are decoded as serialized scenes,
+// while all the other files are parsed as ASCII art by the diagram parser. In the latter case
+// the parser warnings are returned too. The "-" path denotes the standard input, which is
+// decoded as a scene, unless the format says otherwise, if it starts with a JSON object.
+func readScene(path, format string, diagram *canvas.Diagram) (*canvas.Scene, []canvas.Diagnostic, error) {
+	if format != "" && format != "ascii" && format != "json" {
+		return nil, nil, fmt.Errorf("unsupported source format: %q", format)
+	}
+
+	if path == "-" {
+		data, err := goio.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, nil, err
+		}
+		if format == "json" || format == "" && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+			return decodeScene(data)
+		}
+		scene, diags := diagram.Parse(strings.ReplaceAll(string(data), "\r\n", "\n"))
+		return scene, diags, nil
+	}
+
+	if format == "json" || format == "" && strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return decodeScene(data)
+	}
+
+	content, err := io.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	scene, diags := diagram.Parse(content)
+	return scene, diags, nil
+}
+
+// decodeScene decodes the serialized scene.
+func decodeScene(data []byte) (*canvas.Scene, []canvas.Diagnostic, error) {
+	scene := new(canvas.Scene)
+	if err := json.Unmarshal(data, scene); err != nil {
+		return nil, nil, fmt.Errorf("invalid scene: %w", err)
+	}
+	return scene, nil, nil
+}
+
+// writeOutput calls write with the destination file, or with the standard output if the destination is "-".
+// The destination file is replaced only when write succeeds.
+func writeOutput(path string, write func(w goio.Writer) error) error {
+	if path == "-" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := write(w); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+	return canvas.WriteFile(path, write)
+}
+
+// printDiagnostics prints the parser warnings on the standard error.
+func printDiagnostics(path string, diags []canvas.Diagnostic) {
+	for _, diag := range diags {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", path, diag)
+	}
+}
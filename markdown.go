@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/esimov/diagram/canvas"
+	"github.com/esimov/diagram/markdown"
+)
+
+// runMarkdown renders the diagram blocks of the Markdown files and replaces them with image links.
+func runMarkdown(args []string) error {
+	fs := flag.NewFlagSet("markdown", flag.ExitOnError)
+	write := fs.Bool("w", false, "Write the result to the Markdown file instead of the standard output")
+	outDir := fs.String("outdir", "", "Directory of the rendered images (defaults to the diagrams directory next to the Markdown file)")
+	diagramOpts := addDiagramFlags(fs)
+	fontOpts := addFontFlags(fs)
+	fs.Usage = commandUsage("markdown", "<file|glob|dir>...", fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("markdown: missing input file")
+	}
+
+	diagram, err := diagramOpts.diagram()
+	if err != nil {
+		return fmt.Errorf("markdown: %w", err)
+	}
+	fonts, err := fontOpts.loadFonts()
+	if err != nil {
+		return err
+	}
+	digest := renderDigest(diagramOpts, fontOpts)
+
+	files, err := expandInputs(fs.Args(), ".md", ".markdown")
+	if err != nil {
+		return fmt.Errorf("markdown: %w", err)
+	}
+
+	for _, file := range files {
+		doc, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		dir := *outDir
+		if dir == "" {
+			dir = filepath.Join(filepath.Dir(file), "diagrams")
+		}
+		res, err := markdown.Process(doc, func(block markdown.Block) (string, error) {
+			output, err := renderBlock(file, block, dir, diagram, fonts, digest)
+			if err != nil {
+				return "", err
+			}
+
+			link, err := filepath.Rel(filepath.Dir(file), output)
+			if err != nil {
+				return "", err
+			}
+			return filepath.ToSlash(link), nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+
+		if !*write {
+			os.Stdout.Write(res)
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, res, info.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderBlock renders the diagram block into the directory, naming the image after the hash
+// of the diagram source and of the digest of the rendering options. Already existing images
+// are not rendered again.
+func renderBlock(file string, block markdown.Block, dir string, diagram *canvas.Diagram, fonts *canvas.FontSet, digest string) (string, error) {
+	sum := sha256.Sum256([]byte(digest + "\n" + block.Source))
+	output := filepath.Join(dir, "diagram-"+hex.EncodeToString(sum[:6])+".png")
+	if _, err := os.Stat(output); err == nil {
+		return output, nil
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("cannot create the output directory: %w", err)
+	}
+	scene, diags := diagram.Parse(block.Source)
+	// Report the parser warnings relative to the Markdown file.
+	for i := range diags {
+		diags[i].Pos.Line += block.Line
+	}
+	printDiagnostics(file, diags)
+
+	if err := canvas.DrawScene(scene, output, fonts); err != nil {
+		return "", fmt.Errorf("cannot render the diagram: %w", err)
+	}
+	return output, nil
+}
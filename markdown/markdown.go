@@ -0,0 +1,217 @@
+// Package markdown renders the diagrams embedded into Markdown documents.
+//
+// The diagrams are written as fenced code blocks with the "diagram" info string.
+// Each block is replaced with a link to its rendered image, followed by the
+// original source, kept in a collapsible block so the document remains editable.
+// The replaced blocks are delimited by HTML comments, which allows the rendered
+// documents to be processed again after the diagram sources are changed.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Language is the info string of the fenced code blocks holding diagrams.
+const Language = "diagram"
+
+// The markers delimiting the rendered diagram blocks.
+const (
+	beginMarker = "<!-- diagram:begin -->"
+	endMarker   = "<!-- diagram:end -->"
+)
+
+// Block is a diagram found in a Markdown document.
+type Block struct {
+	// Source holds the ASCII art of the diagram.
+	Source string
+	// Title is the text following the info string, used as alternate text of the image.
+	Title string
+	// Line is the line number of the opening fence.
+	Line int
+}
+
+// fence is an opening code fence.
+type fence struct {
+	marker string
+	info   string
+}
+
+// Process replaces the diagram blocks of the document with the links returned by render.
+// The link is the path or URL of the rendered image. The document keeps its line endings:
+// if its first line ends with CRLF, all the lines of the result end with CRLF.
+func Process(doc []byte, render func(Block) (string, error)) ([]byte, error) {
+	i := bytes.IndexByte(doc, '\n')
+	crlf := i > 0 && doc[i-1] == '\r'
+	doc = bytes.ReplaceAll(doc, []byte("\r\n"), []byte("\n"))
+	lines := strings.SplitAfter(string(doc), "\n")
+
+	var out strings.Builder
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// A previously rendered block: re-render the diagram source found inside it.
+		if strings.TrimSpace(line) == beginMarker {
+			end := i + 1
+			for end < len(lines) && strings.TrimSpace(lines[end]) != endMarker {
+				end++
+			}
+			if end == len(lines) {
+				return nil, fmt.Errorf("line %d: missing %q", i+1, endMarker)
+			}
+			block, f, ok := findBlock(lines[i+1:end], i+2)
+			if !ok {
+				return nil, fmt.Errorf("line %d: rendered block without diagram source", i+1)
+			}
+			if err := write(&out, block, f, render); err != nil {
+				return nil, err
+			}
+			i = end
+			continue
+		}
+
+		f, ok := openingFence(line)
+		if !ok {
+			out.WriteString(line)
+			continue
+		}
+		end := closingFence(lines, i+1, f)
+		if f.language() != Language {
+			// Other code blocks are copied verbatim, even if they contain diagram fences.
+			for _, l := range lines[i:min(end+1, len(lines))] {
+				out.WriteString(l)
+			}
+			i = end
+			continue
+		}
+		if end == len(lines) {
+			return nil, fmt.Errorf("line %d: unterminated diagram block", i+1)
+		}
+
+		block := Block{
+			Source: strings.Join(lines[i+1:end], ""),
+			Title:  f.title(),
+			Line:   i + 1,
+		}
+		if err := write(&out, block, f, render); err != nil {
+			return nil, err
+		}
+		i = end
+	}
+	if crlf {
+		return []byte(strings.ReplaceAll(out.String(), "\n", "\r\n")), nil
+	}
+	return []byte(out.String()), nil
+}
+
+// write renders the block and writes its image link followed by the collapsible source.
+func write(out *strings.Builder, block Block, f fence, render func(Block) (string, error)) error {
+	link, err := render(block)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", block.Line, err)
+	}
+	alt := block.Title
+	if alt == "" {
+		alt = Language
+	}
+
+	fmt.Fprintf(out, "%s\n![%s](%s)\n\n", beginMarker, escapeText(alt), escapeLink(link))
+	fmt.Fprintf(out, "<details>\n<summary>Diagram source</summary>\n\n")
+	fmt.Fprintf(out, "%s%s\n%s%s\n\n", f.marker, f.info, block.Source, f.marker)
+	fmt.Fprintf(out, "</details>\n%s\n", endMarker)
+	return nil
+}
+
+// escapeText escapes the characters having a meaning in the Markdown inline text.
+func escapeText(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`\[]()*_<>!&`+"`", r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// escapeLink returns the link as a Markdown link destination. The links containing
+// spaces or parentheses are enclosed in angle brackets.
+func escapeLink(link string) string {
+	if !strings.ContainsAny(link, " ()<>\\") {
+		return link
+	}
+	r := strings.NewReplacer(`\`, `\\`, "<", `\<`, ">", `\>`)
+	return "<" + r.Replace(link) + ">"
+}
+
+// findBlock returns the first diagram block found in the lines. The line numbers start at first.
+func findBlock(lines []string, first int) (Block, fence, bool) {
+	for i, line := range lines {
+		f, ok := openingFence(line)
+		if !ok || f.language() != Language {
+			continue
+		}
+		end := closingFence(lines, i+1, f)
+		if end == len(lines) {
+			break
+		}
+		return Block{
+			Source: strings.Join(lines[i+1:end], ""),
+			Title:  f.title(),
+			Line:   first + i,
+		}, f, true
+	}
+	return Block{}, fence{}, false
+}
+
+// openingFence checks whether the line opens a fenced code block: at least three
+// backticks or tildes, indented with at most three spaces.
+func openingFence(line string) (fence, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return fence{}, false
+	}
+	c := trimmed[0]
+	if c != '`' && c != '~' {
+		return fence{}, false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == c {
+		n++
+	}
+	if n < 3 {
+		return fence{}, false
+	}
+	info := trimmed[n:]
+	if c == '`' && strings.Contains(info, "`") {
+		return fence{}, false
+	}
+	return fence{marker: trimmed[:n], info: info}, true
+}
+
+// closingFence returns the index of the line closing the fence, or len(lines) if the block is not closed.
+func closingFence(lines []string, from int, f fence) int {
+	for i := from; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(line, f.marker) && strings.Trim(line, f.marker[:1]) == "" {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+// language returns the first word of the info string.
+func (f fence) language() string {
+	fields := strings.Fields(f.info)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// title returns the info string following the language.
+func (f fence) title() string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(f.info), f.language()))
+}
@@ -0,0 +1,66 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		link string
+		want string
+	}{
+		{
+			name: "escaped alternate text",
+			doc:  "```diagram [a](javascript:x) *b*\n+-+\n```\n",
+			link: "diagrams/a.png",
+			want: "<!-- diagram:begin -->\n![\\[a\\]\\(javascript:x\\) \\*b\\*](diagrams/a.png)\n\n" +
+				"<details>\n<summary>Diagram source</summary>\n\n" +
+				"```diagram [a](javascript:x) *b*\n+-+\n```\n\n</details>\n<!-- diagram:end -->\n",
+		},
+		{
+			name: "link with spaces",
+			doc:  "```diagram\n+-+\n```\n",
+			link: "my diagrams/a (1).png",
+			want: "<!-- diagram:begin -->\n![diagram](<my diagrams/a (1).png>)\n\n" +
+				"<details>\n<summary>Diagram source</summary>\n\n" +
+				"```diagram\n+-+\n```\n\n</details>\n<!-- diagram:end -->\n",
+		},
+		{
+			name: "CRLF line endings",
+			doc:  "# Title\r\n\r\n```diagram\r\n+-+\r\n```\r\ntext\r\n",
+			link: "a.png",
+			want: "# Title\r\n\r\n<!-- diagram:begin -->\r\n![diagram](a.png)\r\n\r\n" +
+				"<details>\r\n<summary>Diagram source</summary>\r\n\r\n" +
+				"```diagram\r\n+-+\r\n```\r\n\r\n</details>\r\n<!-- diagram:end -->\r\ntext\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Process([]byte(tt.doc), func(block Block) (string, error) {
+				if strings.Contains(block.Source, "\r") {
+					t.Errorf("block source %q contains CR", block.Source)
+				}
+				return tt.link, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+
+			// The rendered document is processed again without changes.
+			again, err := Process(got, func(Block) (string, error) { return tt.link, nil })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(again) != tt.want {
+				t.Errorf("second pass changed the document to\n%q", again)
+			}
+		})
+	}
+}
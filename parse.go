@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/esimov/diagram/io"
+)
+
+// runParse parses the ASCII art from the input file and prints the resulting figures.
+func runParse(args []string) error {
+	fs := flag.NewFlagSet("parse", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the figures as JSON")
+	diagramOpts := addDiagramFlags(fs)
+	fs.Usage = commandUsage("parse", "<file>", fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("parse: missing input file")
+	}
+
+	content, err := io.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("error reading source file: %w", err)
+	}
+
+	diagram, err := diagramOpts.diagram()
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	scene, diags := diagram.Parse(content)
+	printDiagnostics(fs.Arg(0), diags)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(scene)
+	}
+
+	for _, fig := range scene.Figures {
+		fmt.Println(fig)
+	}
+	return nil
+}
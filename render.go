@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+
+	"github.com/esimov/diagram/batch"
+	"github.com/esimov/diagram/canvas"
+)
+
+// runRender renders the diagram sources concurrently into the output directory.
+// Only the sources which changed since their last rendering are processed, unless forced.
+func runRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	outDir := fs.String("outdir", ".", "Output directory")
+	name := fs.String("name", batch.DefaultTemplate, "Output file name template, using the {{.Name}}, {{.Ext}}, {{.Dir}} and {{.Rel}} fields of the source")
+	workers := fs.Int("j", runtime.NumCPU(), "Number of diagrams rendered in parallel")
+	force := fs.Bool("force", false, "Render the sources even if their output is up to date")
+	diagramOpts := addDiagramFlags(fs)
+	fontOpts := addFontFlags(fs)
+	fs.Usage = commandUsage("render", "<file|glob|dir>...", fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitCode(2)
+	}
+
+	diagram, err := diagramOpts.diagram()
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	fonts, err := fontOpts.loadFonts()
+	if err != nil {
+		return err
+	}
+
+	files, err := expandInputs(fs.Args(), ".txt", ".json")
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+	jobs, err := batch.Jobs(files, *outDir, *name, renderDigest(diagramOpts, fontOpts))
+	if err != nil {
+		return fmt.Errorf("render: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results := batch.Run(ctx, jobs, *workers, *force, func(job batch.Job) error {
+		scene, diags, err := readScene(job.Source, "", diagram)
+		if err != nil {
+			return err
+		}
+		printDiagnostics(job.Source, diags)
+		return canvas.DrawScene(scene, job.Output, fonts)
+	})
+
+	for _, res := range results {
+		if res.Err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", res.Source, res.Err)
+		}
+	}
+	summary := batch.Summarize(results)
+	fmt.Fprintf(os.Stderr, "%d files: %s\n", len(results), summary)
+
+	if summary.Failed > 0 {
+		return exitCode(1)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"time"
+
+	"github.com/esimov/diagram/server"
+)
+
+// runServe starts the HTTP render server.
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	maxSize := fs.Int64("max-size", server.DefaultMaxBodySize, "Maximum size of the diagram sources, in bytes")
+	maxCells := fs.Int64("max-cells", server.DefaultMaxCells, "Maximum size of the diagram sources, in columns times rows")
+	maxPixels := fs.Int64("max-pixels", server.DefaultMaxPixels, "Maximum size of the rendered images, in width times height")
+	timeout := fs.Duration("timeout", server.DefaultTimeout, "Maximum duration of rendering a diagram")
+	maxRenders := fs.Int("max-renders", runtime.GOMAXPROCS(0), "Maximum number of diagrams rendered at the same time")
+	fontOpts := addFontFlags(fs)
+	fs.Usage = commandUsage("serve", "", fs)
+	fs.Parse(args)
+
+	fonts, err := fontOpts.loadFonts()
+	if err != nil {
+		return err
+	}
+
+	srv := server.New(fonts)
+	srv.MaxBodySize = *maxSize
+	srv.MaxCells = *maxCells
+	srv.MaxPixels = *maxPixels
+	srv.Timeout = *timeout
+	srv.MaxRenders = *maxRenders
+
+	httpServer := &http.Server{
+		Addr:              *addr,
+		Handler:           srv.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      *timeout + 30*time.Second,
+		IdleTimeout:       2 * time.Minute,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("listening on %s", *addr)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
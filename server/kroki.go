@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/esimov/diagram/canvas"
+)
+
+// KrokiType is the diagram type served through the Kroki protocol.
+const KrokiType = "diagram"
+
+// handleKrokiGet serves the GET /{type}/{format}/{source} endpoint of the Kroki protocol,
+// where the source is the deflate compressed and base64url encoded diagram.
+func (s *Server) handleKrokiGet(w http.ResponseWriter, r *http.Request) {
+	opts, ok := s.krokiOptions(w, r)
+	if !ok {
+		return
+	}
+
+	src, err := decodeKroki(r.PathValue("source"), s.MaxBodySize)
+	var tooLarge *tooLargeError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.render(w, r, src, stableSeed(opts, src))
+}
+
+// handleKrokiPost serves the POST /{type}/{format} endpoint of the Kroki protocol,
+// which receives the diagram source as plain text.
+func (s *Server) handleKrokiPost(w http.ResponseWriter, r *http.Request) {
+	opts, ok := s.krokiOptions(w, r)
+	if !ok {
+		return
+	}
+
+	src, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	s.render(w, r, src, stableSeed(opts, src))
+}
+
+// krokiRequest is the JSON request of the Kroki protocol. The diagram options are
+// the query parameters of the render endpoint, except the format.
+type krokiRequest struct {
+	DiagramSource  string            `json:"diagram_source"`
+	DiagramType    string            `json:"diagram_type"`
+	OutputFormat   string            `json:"output_format"`
+	DiagramOptions map[string]string `json:"diagram_options"`
+}
+
+// handleKrokiJSON serves the POST / endpoint of the Kroki protocol, which receives the diagram
+// source, its type and the output format as a JSON object.
+func (s *Server) handleKrokiJSON(w http.ResponseWriter, r *http.Request) {
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	var req krokiRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid JSON request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DiagramType != KrokiType {
+		http.Error(w, fmt.Sprintf("unsupported diagram type %q, only %q is available", req.DiagramType, KrokiType), http.StatusBadRequest)
+		return
+	}
+	format, err := parseFormat(req.OutputFormat, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := make(url.Values)
+	for name, value := range req.DiagramOptions {
+		query.Set(name, value)
+	}
+	query.Del("format")
+	opts, err := s.parseOptions(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Format = format
+	src := []byte(req.DiagramSource)
+	s.render(w, r, src, stableSeed(opts, src))
+}
+
+// krokiOptions returns the rendering options defined by the request path and query parameters.
+// In case of an error it replies to the request and returns false.
+func (s *Server) krokiOptions(w http.ResponseWriter, r *http.Request) (canvas.Options, bool) {
+	if typ := r.PathValue("type"); typ != KrokiType {
+		http.Error(w, fmt.Sprintf("unsupported diagram type %q, only %q is available", typ, KrokiType), http.StatusBadRequest)
+		return canvas.Options{}, false
+	}
+	format, err := parseFormat(r.PathValue("format"), false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return canvas.Options{}, false
+	}
+
+	opts, err := s.options(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return canvas.Options{}, false
+	}
+	opts.Format = format
+	return opts, true
+}
+
+// stableSeed derives the seed from the diagram source, unless it's explicitly requested,
+// so the same URL always results in the same image, as expected by the caching Kroki clients.
+func stableSeed(opts canvas.Options, src []byte) canvas.Options {
+	if opts.Seed == 0 {
+		h := fnv.New64a()
+		h.Write(src)
+		opts.Seed = int64(h.Sum64() >> 1)
+	}
+	return opts
+}
+
+// tooLargeError reports a decoded diagram source exceeding the size limit.
+type tooLargeError struct {
+	limit int64
+}
+
+func (e *tooLargeError) Error() string {
+	return fmt.Sprintf("diagram exceeds %d bytes", e.limit)
+}
+
+// decodeKroki decodes the diagram source encoded in the URL. The compressed data may have
+// the zlib header or not, and the size of the decompressed source is limited to maxSize bytes.
+func decodeKroki(encoded string, maxSize int64) ([]byte, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, errors.New("invalid encoding, the diagram should be base64url encoded")
+	}
+
+	var zr io.Reader
+	if r, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		zr = r
+	} else {
+		zr = flate.NewReader(bytes.NewReader(data))
+	}
+
+	src, err := io.ReadAll(io.LimitReader(zr, maxSize+1))
+	if err != nil {
+		return nil, errors.New("invalid compression, the diagram should be deflate compressed")
+	}
+	if int64(len(src)) > maxSize {
+		return nil, &tooLargeError{maxSize}
+	}
+	return src, nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/esimov/diagram/canvas"
+)
+
+func TestDecodeKroki(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		want    string
+	}{
+		{
+			name:    "zlib",
+			encoded: "eNrT1gUBba4aBccAT4UaINuOSxsqBgBRrgVk",
+			want:    "+-----+\n| API |--->\n+-----+\n",
+		},
+		{
+			name:    "zlib with padding",
+			encoded: "eNrT1gUBba4ahcSCTIUaINsuOiUplksbKg4AexkHQg==",
+			want:    "+-----+\n| api |--->[db]\n+-----+\n",
+		},
+		{
+			name:    "raw deflate",
+			encoded: "09YFAW2uGoXEgkyFGiDbLjolKZZLGyoOAA==",
+			want:    "+-----+\n| api |--->[db]\n+-----+\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeKroki(tt.encoded, 1<<10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// zlibBomb returns a few hundred bytes of zlib compressed data inflating to 1 MiB.
+func zlibBomb() []byte {
+	var buf bytes.Buffer
+	zw, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+	zw.Write(bytes.Repeat([]byte(" "), 1<<20))
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestDecodeKrokiErrors(t *testing.T) {
+	bomb := zlibBomb()
+	if _, err := decodeKroki("not*base64", 1<<10); err == nil || !strings.Contains(err.Error(), "base64url") {
+		t.Errorf("invalid encoding: got error %v", err)
+	}
+	if _, err := decodeKroki(base64.RawURLEncoding.EncodeToString([]byte("plain text")), 1<<10); err == nil || !strings.Contains(err.Error(), "compress") {
+		t.Errorf("invalid compression: got error %v", err)
+	}
+
+	var tooLarge *tooLargeError
+	_, err := decodeKroki(base64.RawURLEncoding.EncodeToString(bomb), 1<<10)
+	if !errors.As(err, &tooLarge) {
+		t.Errorf("zlib bomb: got error %v", err)
+	}
+}
+
+func TestKroki(t *testing.T) {
+	fonts, err := canvas.DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(fonts)
+	srv.MaxBodySize = 1 << 10
+	handler := srv.Handler()
+
+	bomb := zlibBomb()
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		want        int
+		contentType string
+	}{
+		{"get", http.MethodGet, "/diagram/svg/eNrT1gUBba4aBccAT4UaINuOSxsqBgBRrgVk", "", http.StatusOK, "image/svg+xml"},
+		{"get format alias", http.MethodGet, "/diagram/jpg/eNrT1gUBba4aBccAT4UaINuOSxsqBgBRrgVk", "", http.StatusOK, "image/jpeg"},
+		{"get zlib bomb", http.MethodGet, "/diagram/svg/" + base64.RawURLEncoding.EncodeToString(bomb), "", http.StatusRequestEntityTooLarge, ""},
+		{"get unknown type", http.MethodGet, "/plantuml/svg/eNrT1gUBba4aBccAT4UaINuOSxsqBgBRrgVk", "", http.StatusBadRequest, ""},
+		{"post", http.MethodPost, "/diagram/png", "+---+\n| a |\n+---+\n", http.StatusOK, "image/png"},
+		{"post json", http.MethodPost, "/", `{"diagram_source": "+---+\n| a |\n+---+\n", "diagram_type": "diagram", "output_format": "svg", "diagram_options": {"theme": "dark"}}`, http.StatusOK, "image/svg+xml"},
+		{"post json unknown type", http.MethodPost, "/", `{"diagram_source": "a", "diagram_type": "ditaa", "output_format": "svg"}`, http.StatusBadRequest, ""},
+		{"post json unknown format", http.MethodPost, "/", `{"diagram_source": "a", "diagram_type": "diagram", "output_format": "txt"}`, http.StatusBadRequest, ""},
+		{"post json invalid option", http.MethodPost, "/", `{"diagram_source": "a", "diagram_type": "diagram", "output_format": "svg", "diagram_options": {"theme": "pink"}}`, http.StatusBadRequest, ""},
+		{"post invalid json", http.MethodPost, "/", `{"diagram_source": `, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if got := rec.Header().Get("Content-Type"); tt.contentType != "" && got != tt.contentType {
+				t.Errorf("got content type %q, want %q", got, tt.contentType)
+			}
+		})
+	}
+}
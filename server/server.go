@@ -0,0 +1,289 @@
+// Package server implements an HTTP service rendering the ASCII arts into hand drawn diagrams.
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/esimov/diagram/canvas"
+)
+
+//go:embed playground.html
+var playground []byte
+
+// The default limits of the server.
+const (
+	DefaultMaxBodySize = 1 << 20
+	DefaultMaxCells    = 1 << 20
+	DefaultMaxPixels   = 1 << 25
+	DefaultTimeout     = 10 * time.Second
+
+	// maxScale limits the scale factor, so the size of the rendered images stays reasonable.
+	maxScale = 4
+)
+
+// Server renders the diagrams sent over HTTP. It's safe for concurrent use.
+type Server struct {
+	// Fonts holds the fonts used for rendering the diagrams.
+	Fonts *canvas.FontSet
+	// MaxBodySize limits the size of the diagram sources, in bytes.
+	MaxBodySize int64
+	// MaxCells limits the size of the ASCII grid of the diagrams, its columns times its rows.
+	MaxCells int64
+	// MaxPixels limits the size of the rendered images, their width times their height.
+	MaxPixels int64
+	// Timeout limits the time spent parsing and rendering a diagram.
+	Timeout time.Duration
+	// MaxRenders limits the number of diagrams rendered at the same time. It's read by Handler.
+	MaxRenders int
+
+	// renders holds a token for each diagram being rendered, including the ones which timed out.
+	renders chan struct{}
+}
+
+// New returns a server using the given fonts and the default limits.
+func New(fonts *canvas.FontSet) *Server {
+	return &Server{
+		Fonts:       fonts,
+		MaxBodySize: DefaultMaxBodySize,
+		MaxCells:    DefaultMaxCells,
+		MaxPixels:   DefaultMaxPixels,
+		Timeout:     DefaultTimeout,
+		MaxRenders:  runtime.GOMAXPROCS(0),
+	}
+}
+
+// Handler returns the HTTP handler of the server, which serves the following endpoints:
+//
+//	GET  /                          the playground page
+//	POST /render                    renders the ASCII art sent in the request body
+//	GET  /diagram/{format}/{source} renders the deflate compressed, base64url encoded ASCII art (Kroki protocol)
+//	POST /diagram/{format}          renders the ASCII art sent in the request body (Kroki protocol)
+//	POST /                          renders the ASCII art sent as a JSON request (Kroki protocol)
+//
+// The render endpoint accepts the format (png, png8, jpeg, gif, svg, pdf, json or dot), seed, theme, scale, mode and compat
+// query parameters, while the Kroki endpoints take the image format from the path.
+// The diagrams exceeding MaxBodySize or MaxCells are rejected with 413 Request Entity Too Large,
+// the ones whose image would exceed MaxPixels with 422 Unprocessable Entity. When MaxRenders
+// diagrams are already being rendered, the requests are rejected with 503 Service Unavailable.
+func (s *Server) Handler() http.Handler {
+	s.renders = make(chan struct{}, cmp.Or(max(s.MaxRenders, 0), runtime.GOMAXPROCS(0)))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handlePlayground)
+	mux.HandleFunc("POST /{$}", s.handleKrokiJSON)
+	mux.HandleFunc("POST /render", s.handleRender)
+	mux.HandleFunc("GET /{type}/{format}/{source}", s.handleKrokiGet)
+	mux.HandleFunc("POST /{type}/{format}", s.handleKrokiPost)
+	return mux
+}
+
+// handlePlayground serves the HTML page for trying out the renderer.
+func (s *Server) handlePlayground(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(playground)
+}
+
+// handleRender renders the ASCII art sent in the request body.
+func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
+	opts, err := s.options(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	src, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+	s.render(w, r, src, opts)
+}
+
+// readBody reads the diagram source from the request body, limiting its size.
+// In case of an error it replies to the request and returns false.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	src, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.MaxBodySize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, fmt.Sprintf("diagram exceeds %d bytes", maxErr.Limit), http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, "error reading the diagram", http.StatusBadRequest)
+		return nil, false
+	}
+	return src, true
+}
+
+// render writes the diagram in the format defined by the options, or its scene for the JSON format.
+func (s *Server) render(w http.ResponseWriter, r *http.Request, src []byte, opts canvas.Options) {
+	src = bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n"))
+	if cols, rows := gridSize(src); int64(cols)*int64(rows) > s.MaxCells {
+		http.Error(w, fmt.Sprintf("diagram of %dx%d cells exceeds %d cells", cols, rows, s.MaxCells), http.StatusRequestEntityTooLarge)
+		return
+	}
+	opts.MaxPixels = s.MaxPixels
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.Timeout)
+	defer cancel()
+
+	// The diagram is processed in the background, so the deadline also holds for the parsing
+	// and for the description of the diagram, which cannot be interrupted. The rendering keeps
+	// its token until it ends, even after the deadline, so the interrupted renders are counted too.
+	select {
+	case s.renders <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "too many diagrams being rendered", http.StatusServiceUnavailable)
+		return
+	}
+	type result struct {
+		contentType string
+		data        []byte
+		err         error
+	}
+	done := make(chan result, 1)
+	go func() {
+		contentType, data, err := encode(ctx, src, opts)
+		<-s.renders
+		done <- result{contentType, data, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+
+	switch {
+	case res.err == nil:
+		w.Header().Set("Content-Type", res.contentType)
+		w.Write(res.data)
+	case errors.Is(res.err, canvas.ErrImageTooLarge):
+		http.Error(w, res.err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(res.err, context.DeadlineExceeded):
+		http.Error(w, "rendering timed out", http.StatusServiceUnavailable)
+	case errors.Is(res.err, context.Canceled):
+		// The client is gone.
+	default:
+		log.Printf("render error: %v", res.err)
+		http.Error(w, "error rendering the diagram", http.StatusInternalServerError)
+	}
+}
+
+// encode parses the diagram and encodes it in the format defined by the options, returning its MIME type.
+// The result is buffered, so the errors can still be reported with the proper status. The deadline is
+// checked between the parsing, the drawing and the description of the diagram.
+func encode(ctx context.Context, src []byte, opts canvas.Options) (string, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	diagram := &canvas.Diagram{Mode: opts.Mode, Compat: opts.Compat}
+	scene, _ := diagram.Parse(string(src))
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	switch opts.Format {
+	case "json":
+		err := json.NewEncoder(&buf).Encode(scene)
+		return "application/json", buf.Bytes(), err
+	case "dot":
+		err := canvas.WriteDOT(&buf, scene)
+		return "text/vnd.graphviz", buf.Bytes(), err
+	}
+	if _, err := canvas.RenderScene(ctx, scene, &buf, opts); err != nil {
+		return "", nil, err
+	}
+	return opts.Format.MIMEType(), buf.Bytes(), nil
+}
+
+// gridSize returns the number of columns and rows of the ASCII art.
+func gridSize(src []byte) (cols, rows int) {
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		cols = max(cols, utf8.RuneCount(line))
+		rows++
+	}
+	return cols, rows
+}
+
+// parseFormat returns the output format with the given name: one of the image formats, with the same
+// names and aliases as in the command line, or the json and dot formats of the render endpoint.
+func parseFormat(name string, data bool) (canvas.Format, error) {
+	if data && (name == "json" || name == "dot") {
+		return canvas.Format(name), nil
+	}
+	return canvas.ParseFormat(name)
+}
+
+// options returns the rendering options defined by the query parameters.
+func (s *Server) options(r *http.Request) (canvas.Options, error) {
+	return s.parseOptions(r.URL.Query())
+}
+
+// parseOptions returns the rendering options defined by the parameters.
+func (s *Server) parseOptions(query url.Values) (canvas.Options, error) {
+	opts := canvas.Options{
+		Format: canvas.PNG,
+		Fonts:  s.Fonts,
+	}
+
+	if name := query.Get("format"); name != "" {
+		format, err := parseFormat(name, true)
+		if err != nil {
+			return opts, err
+		}
+		opts.Format = format
+	}
+	if seed := query.Get("seed"); seed != "" {
+		v, err := strconv.ParseInt(seed, 10, 64)
+		if err != nil {
+			return opts, fmt.Errorf("invalid seed %q", seed)
+		}
+		opts.Seed = v
+	}
+	if scale := query.Get("scale"); scale != "" {
+		v, err := strconv.ParseFloat(scale, 64)
+		if err != nil || v <= 0 || v > maxScale {
+			return opts, fmt.Errorf("invalid scale %q, it should be between 0 and %d", scale, maxScale)
+		}
+		opts.Scale = v
+	}
+	if name := query.Get("theme"); name != "" {
+		theme, ok := canvas.Themes[name]
+		if !ok {
+			return opts, fmt.Errorf("unknown theme %q", name)
+		}
+		opts.Theme = &theme
+	}
+	if mode := query.Get("mode"); mode != "" {
+		m, err := canvas.ParseMode(mode)
+		if err != nil {
+			return opts, err
+		}
+		opts.Mode = m
+	}
+	if compat := query.Get("compat"); compat != "" {
+		c, err := canvas.ParseCompat(compat)
+		if err != nil {
+			return opts, err
+		}
+		opts.Compat = c
+	}
+	return opts, nil
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/esimov/diagram/canvas"
+)
+
+func TestRenderLimits(t *testing.T) {
+	fonts, err := canvas.DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(fonts)
+	srv.MaxCells = 100 * 100
+	srv.MaxPixels = 1000 * 1000
+	handler := srv.Handler()
+
+	box := "+---+\n| a |\n+---+\n"
+	tests := []struct {
+		name  string
+		query string
+		src   string
+		want  int
+	}{
+		{"small diagram", "format=png", box, http.StatusOK},
+		{"format alias", "format=jpg", box, http.StatusOK},
+		{"pdf", "format=pdf", box, http.StatusOK},
+		{"unknown format", "format=bmp", box, http.StatusBadRequest},
+		{"too many cells", "format=json", strings.Repeat(" ", 101) + strings.Repeat("\n", 100), http.StatusRequestEntityTooLarge},
+		{"too many pixels", "format=png&scale=4", box + strings.Repeat("-", 99) + strings.Repeat("\n|", 50), http.StatusUnprocessableEntity},
+		{"too many pixels as svg", "format=svg&scale=4", box + strings.Repeat("-", 99) + strings.Repeat("\n|", 50), http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/render?"+tt.query, strings.NewReader(tt.src))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRenderConcurrency(t *testing.T) {
+	fonts, err := canvas.DefaultFontSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(fonts)
+	srv.MaxRenders = 1
+	handler := srv.Handler()
+
+	render := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/render?format=svg", strings.NewReader("+---+\n| a |\n+---+\n"))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A render still running, even after its deadline, holds its token.
+	srv.renders <- struct{}{}
+	if rec := render(); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("got status %d, want %d with Retry-After", rec.Code, http.StatusServiceUnavailable)
+	}
+	<-srv.renders
+	rec := render()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "image/svg+xml" {
+		t.Errorf("got content type %q, want image/svg+xml", got)
+	}
+	// The token is released when the render ends.
+	if len(srv.renders) != 0 {
+		t.Errorf("%d renders still hold a token", len(srv.renders))
+	}
+}
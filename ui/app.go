@@ -2,11 +2,13 @@ package ui
 
 import (
 	"os"
+
+	"github.com/esimov/diagram/canvas"
 )
 
 // InitApp initialize the CLI application.
-func InitApp(fontPath, content string) {
-	ui := NewUI(fontPath)
+func InitApp(fonts *canvas.FontSet, content string) {
+	ui := NewUI(fonts)
 
 	// This will close the Gio application, which is running on the main thread.
 	defer func() {
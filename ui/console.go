@@ -1,5 +1,12 @@
 package ui
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/esimov/diagram/canvas"
+)
+
 type AnsiColor int
 
 const (
@@ -38,3 +45,13 @@ func (ui *UI) log(message string, isError bool) error {
 func (ui *UI) clearLog() error {
 	return ui.writeContent(logPanel, "")
 }
+
+// logDiagnostics writes the parser warnings into the log panel.
+func (ui *UI) logDiagnostics(diags []canvas.Diagnostic) error {
+	var sb strings.Builder
+	sb.WriteString(decorate(fmt.Sprintf("The diagram has been generated with %d warning(s):", len(diags)), Yellow))
+	for _, diag := range diags {
+		sb.WriteString("\n" + decorate(diag.String(), Yellow))
+	}
+	return ui.writeContent(logPanel, sb.String())
+}
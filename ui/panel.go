@@ -3,7 +3,6 @@ package ui
 import (
 	_ "embed"
 	"fmt"
-	"image"
 	"log"
 	"os"
 	"path/filepath"
@@ -457,7 +456,8 @@ func (ui *UI) generateDiagram(name string) error {
 	}
 
 	// Generate the hand-drawn diagram.
-	err = canvas.DrawDiagram(v.Buffer(), diagram, ui.fontPath)
+	scene, diags := (&canvas.Diagram{}).Parse(v.Buffer())
+	err = canvas.DrawScene(scene, diagram, ui.fonts)
 	if err != nil {
 		_ = ui.closeModal(progressModal)
 		return fmt.Errorf("failed generating diagram: %w", err)
@@ -478,10 +478,18 @@ func (ui *UI) generateDiagram(name string) error {
 				ui.modalTimer.Stop()
 			}
 
+			if len(diags) > 0 {
+				return ui.logDiagnostics(diags)
+			}
 			return ui.log("The ASCII diagram has been successfully converted to hand drawn diagram.", false)
 		})
 	})
 
+	// Keep the warnings visible until the next action.
+	if len(diags) > 0 {
+		return nil
+	}
+
 	defer func() {
 		// Hide log message after 4 seconds
 		ui.logTimer = time.AfterFunc(4*time.Second, func() {
@@ -500,7 +508,7 @@ func (ui *UI) showDiagram(diagram string) error {
 		return fmt.Errorf("failed opening the image %q: %w", diagram, err)
 	}
 
-	srcImg, _, err := image.Decode(f)
+	srcImg, err := canvas.Decode(f)
 	if err != nil {
 		return fmt.Errorf("failed to decode the image %q: %w", diagram, err)
 	}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/esimov/diagram/canvas"
 	"github.com/jroimartin/gocui"
 )
 
@@ -19,13 +20,13 @@ type UI struct {
 	activeModalView    int
 	currentModal       string
 	consoleLog         string
-	fontPath           string
+	fonts              *canvas.FontSet
 	defaultContent     string
 	widgetItems        map[string][]string
 }
 
 // NewUI returns a new UI component.
-func NewUI(fontPath string) *UI {
+func NewUI(fonts *canvas.FontSet) *UI {
 	var err error
 
 	ui := new(UI)
@@ -35,7 +36,7 @@ func NewUI(fontPath string) *UI {
 	}
 
 	ui.cursors = NewCursors()
-	ui.fontPath = fontPath
+	ui.fonts = fonts
 
 	return ui
 }
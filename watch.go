@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/esimov/diagram/batch"
+	"github.com/esimov/diagram/canvas"
+	"github.com/esimov/diagram/gui"
+)
+
+// runWatch polls the source files and re-renders them whenever they change.
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	in := fs.String("in", "", "Source file, glob or directory to watch")
+	out := fs.String("out", ".", "Output directory, or output file if the source is a single file")
+	name := fs.String("name", batch.DefaultTemplate, "Output file name template, using the {{.Name}}, {{.Ext}}, {{.Dir}} and {{.Rel}} fields of the source")
+	interval := fs.Duration("interval", 500*time.Millisecond, "Polling interval")
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "Time a source must remain unchanged before it's rendered")
+	showPreview := fs.Bool("preview", false, "Show the last rendered diagram in the preview window")
+	diagramOpts := addDiagramFlags(fs)
+	fontOpts := addFontFlags(fs)
+	fs.Usage = commandUsage("watch", "", fs)
+	fs.Parse(args)
+
+	if *in == "" {
+		fs.Usage()
+		return errors.New("watch: missing source")
+	}
+
+	diagram, err := diagramOpts.diagram()
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	fonts, err := fontOpts.loadFonts()
+	if err != nil {
+		return err
+	}
+
+	// A single source file can be rendered straight into the output file.
+	outDir, nameTemplate := *out, *name
+	if info, err := os.Stat(*in); err == nil && !info.IsDir() && isImageFile(*out) {
+		outDir, nameTemplate = filepath.Dir(*out), filepath.Base(*out)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var preview *gui.GUI
+	if *showPreview {
+		preview = gui.NewGUI()
+	}
+
+	watcher := &batch.Watcher{
+		List: func() ([]batch.Job, error) {
+			files, err := expandInputs([]string{*in}, ".txt", ".json")
+			if err != nil {
+				return nil, err
+			}
+			return batch.Jobs(files, outDir, nameTemplate, renderDigest(diagramOpts, fontOpts))
+		},
+		Render: func(job batch.Job) error {
+			scene, diags, err := readScene(job.Source, "", diagram)
+			if err != nil {
+				return err
+			}
+			printDiagnostics(job.Source, diags)
+			return canvas.DrawScene(scene, job.Output, fonts)
+		},
+		Report: func(res batch.Result) {
+			if res.Err != nil {
+				log.Printf("%s: %v", res.Source, res.Err)
+				return
+			}
+			log.Printf("%s -> %s (%v)", res.Source, res.Output, res.Duration.Round(time.Millisecond))
+
+			if preview != nil {
+				img, err := decodeImage(res.Output)
+				if err != nil {
+					log.Printf("cannot preview %s: %v", res.Output, err)
+					return
+				}
+				preview.Reload(img)
+			}
+		},
+		Error: func(err error) {
+			log.Printf("watch: %v", err)
+		},
+		Interval: *interval,
+		Debounce: *debounce,
+		Workers:  runtime.NumCPU(),
+	}
+
+	log.Printf("watching %s, press Ctrl+C to stop", *in)
+	if preview == nil {
+		if err := watcher.Run(ctx); !errors.Is(err, context.Canceled) {
+			return err
+		}
+		return nil
+	}
+
+	go watcher.Run(ctx)
+
+	// The preview window is shown until it's closed, starting with an empty image
+	// which is replaced by the first rendered diagram, resizing the window to fit it.
+	return preview.Draw(image.NewRGBA(image.Rect(0, 0, previewSize, previewSize)))
+}
+
+// previewSize defines the size of the placeholder image shown before the first rendering.
+const previewSize = 720
+
+// isImageFile reports whether the path has the extension of one of the output formats.
+func isImageFile(path string) bool {
+	_, err := canvas.ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	return err == nil
+}
+
+// decodeImage reads the image from the file.
+func decodeImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return canvas.Decode(f)
+}